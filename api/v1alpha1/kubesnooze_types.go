@@ -1,9 +1,24 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// AnnotationPostponeUntil holds an RFC3339 time on a KubeSnooze. Scheduled
+// sleeps are held back until then; a sleep missed meanwhile runs once it passes.
+const AnnotationPostponeUntil = "kubesnooze.io/postpone-until"
+
+// DeletionPolicy says what happens to the workloads when a KubeSnooze is deleted.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyLeave leaves the workloads as they are, asleep or awake.
+	DeletionPolicyLeave DeletionPolicy = "Leave"
+	// DeletionPolicyWake wakes the workloads before the KubeSnooze goes away.
+	DeletionPolicyWake DeletionPolicy = "Wake"
+)
+
 // SnoozeBehavior defines how kubesnooze adjusts workloads during sleep or wake.
 type SnoozeBehavior struct {
 	// Replicas is the desired replica count for Deployments/StatefulSets.
@@ -14,6 +29,56 @@ type SnoozeBehavior struct {
 	SuspendCronJobs *bool `json:"suspendCronJobs,omitempty"`
 }
 
+// SleepBehavior is the SnoozeBehavior for sleep, plus the settings only sleep
+// uses. Wake undoes whatever strategy the sleep applied.
+type SleepBehavior struct {
+	SnoozeBehavior `json:",inline"`
+	// HPAStrategy selects how HPAs are put to sleep. MinReplicas (default) lowers
+	// minReplicas; Delete snapshots the HPA onto its scale target, scales the
+	// target to Replicas and removes the HPA until wake recreates it.
+	//+kubebuilder:validation:Enum=MinReplicas;Delete
+	HPAStrategy string `json:"hpaStrategy,omitempty"`
+}
+
+// SplashRoute maps requests reaching a cluster-wide splash server to a
+// KubeSnooze. At least one of Host and PathPrefix must be set; when both are,
+// both must match.
+type SplashRoute struct {
+	// Host matches the request Host header, ignoring case and port.
+	Host string `json:"host,omitempty"`
+	// PathPrefix matches the beginning of the request path.
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// RunnerPodTemplate customizes the pods of the runner CronJobs. Unset fields
+// keep the defaults: a non-root, read-only container with all capabilities
+// dropped, the RuntimeDefault seccomp profile and small requests and limits.
+// Set fields replace the matching default as a whole.
+type RunnerPodTemplate struct {
+	// Labels are added to runner pods, e.g. for NetworkPolicies.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to runner pods.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Resources of the runner container.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// SecurityContext of the runner container.
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// PodSecurityContext of the runner pod.
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// NodeSelector constrains where runner pods are scheduled.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations of runner pods.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity of runner pods.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// ImagePullSecrets for a runner image in a private registry.
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// ImagePullPolicy of the runner container.
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// PriorityClassName of runner pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
 // KubeSnoozeSpec defines the desired state of KubeSnooze.
 type KubeSnoozeSpec struct {
 	// Selector targets workloads in the namespace.
@@ -26,10 +91,70 @@ type KubeSnoozeSpec struct {
 	Timezone string `json:"timezone,omitempty"`
 	// RunnerImage is the image used by the runner pods.
 	RunnerImage string `json:"runnerImage,omitempty"`
+	// RunnerPodTemplate customizes the runner pods.
+	RunnerPodTemplate *RunnerPodTemplate `json:"runnerPodTemplate,omitempty"`
+	// StartingDeadlineSeconds is how late a runner Job may start after its
+	// schedule; later sleeps are caught up by the controller. Defaults to 300.
+	//+kubebuilder:validation:Minimum=0
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// BackoffLimit is how often a failed runner pod is retried. Defaults to 2.
+	//+kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// ActiveDeadlineSeconds bounds how long a runner Job may run. Defaults to 600.
+	//+kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// TTLSecondsAfterFinished is how long finished runner Jobs are kept.
+	// Defaults to 86400.
+	//+kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// SuccessfulJobsHistoryLimit is how many succeeded runner Jobs each CronJob
+	// keeps. Defaults to 1.
+	//+kubebuilder:validation:Minimum=0
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// FailedJobsHistoryLimit is how many failed runner Jobs each CronJob keeps.
+	// Defaults to 3.
+	//+kubebuilder:validation:Minimum=0
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
 	// Sleep describes how to scale down workloads.
-	Sleep SnoozeBehavior `json:"sleep"`
+	Sleep SleepBehavior `json:"sleep"`
 	// Wake describes how to scale up workloads.
 	Wake SnoozeBehavior `json:"wake"`
+	// Suspend pauses both schedules, including catch-up of missed sleeps,
+	// without deleting the KubeSnooze.
+	Suspend bool `json:"suspend,omitempty"`
+	// WakeOnSuspend wakes the workloads once each time Suspend is set, so a
+	// paused environment is not left asleep.
+	WakeOnSuspend bool `json:"wakeOnSuspend,omitempty"`
+	// DeletionPolicy is Leave (default) or Wake. With Wake, deleting the
+	// KubeSnooze first runs a wake Job, so nothing is left asleep.
+	//+kubebuilder:validation:Enum=Leave;Wake
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// SplashRoutes are the hosts and paths a cluster-wide splash server wakes
+	// this KubeSnooze for.
+	SplashRoutes []SplashRoute `json:"splashRoutes,omitempty"`
+}
+
+// MaxWakeHistory is how many wakes KubeSnoozeStatus.WakeHistory keeps.
+const MaxWakeHistory = 10
+
+// WakeRecord is one entry of the wake audit trail.
+type WakeRecord struct {
+	// Time is when the wake ran.
+	Time metav1.Time `json:"time"`
+	// Source is what triggered the wake: splash, cli or schedule.
+	Source string `json:"source"`
+	// User is the caller, when known.
+	User string `json:"user,omitempty"`
+	// SourceIP is the client address of a splash request.
+	SourceIP string `json:"sourceIP,omitempty"`
+	// Selectors are the label selectors that were woken.
+	Selectors []string `json:"selectors,omitempty"`
+	// Changes lists the objects changed, e.g. "Deployment/web replicas: 0 -> 2".
+	Changes []string `json:"changes,omitempty"`
+	// Result is Succeeded or Failed.
+	Result string `json:"result"`
+	// Message is the error of a failed wake.
+	Message string `json:"message,omitempty"`
 }
 
 // KubeSnoozeStatus defines the observed state of KubeSnooze.
@@ -40,8 +165,24 @@ type KubeSnoozeStatus struct {
 	LastSleepTime *metav1.Time `json:"lastSleepTime,omitempty"`
 	// LastWakeTime is when the last wake action ran.
 	LastWakeTime *metav1.Time `json:"lastWakeTime,omitempty"`
+	// LastSleepCatchUpTime is the missed sleep schedule most recently run by a
+	// catch-up Job.
+	LastSleepCatchUpTime *metav1.Time `json:"lastSleepCatchUpTime,omitempty"`
 	// Conditions represent the latest available observations.
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// WakeHistory holds the most recent wakes, newest first.
+	//+kubebuilder:validation:MaxItems=10
+	WakeHistory []WakeRecord `json:"wakeHistory,omitempty"`
+}
+
+// RecordWake adds record to the front of the wake history, dropping the
+// oldest entries beyond MaxWakeHistory.
+func (s *KubeSnoozeStatus) RecordWake(record WakeRecord) {
+	history := append([]WakeRecord{record}, s.WakeHistory...)
+	if len(history) > MaxWakeHistory {
+		history = history[:MaxWakeHistory]
+	}
+	s.WakeHistory = history
 }
 
 //+kubebuilder:object:root=true
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -29,3 +30,34 @@ func TestSnoozeBehavior_Replicas(t *testing.T) {
 		t.Error("wake Replicas should be 1")
 	}
 }
+
+func TestSleepBehavior_HPAStrategyIsSleepOnly(t *testing.T) {
+	var spec KubeSnoozeSpec
+	raw := `{"sleep":{"replicas":0,"hpaStrategy":"Delete"},"wake":{"replicas":1,"hpaStrategy":"Delete"}}`
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.Sleep.Replicas == nil || *spec.Sleep.Replicas != 0 || spec.Sleep.HPAStrategy != "Delete" {
+		t.Errorf("sleep = %+v, want replicas 0 and the Delete strategy", spec.Sleep)
+	}
+	out, err := json.Marshal(spec.Wake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"replicas":1}` {
+		t.Errorf("wake = %s, want no hpaStrategy", out)
+	}
+}
+
+func TestKubeSnoozeStatus_RecordWake(t *testing.T) {
+	var status KubeSnoozeStatus
+	for i := 0; i < MaxWakeHistory+3; i++ {
+		status.RecordWake(WakeRecord{Source: "splash", User: string(rune('a' + i)), Result: "Succeeded"})
+	}
+	if len(status.WakeHistory) != MaxWakeHistory {
+		t.Fatalf("history length = %d, want %d", len(status.WakeHistory), MaxWakeHistory)
+	}
+	if newest := status.WakeHistory[0].User; newest != string(rune('a'+MaxWakeHistory+2)) {
+		t.Errorf("newest entry = %q, want the last recorded", newest)
+	}
+}
@@ -9,6 +9,7 @@ Copyright 2026.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -43,12 +44,68 @@ func (in *SnoozeBehavior) DeepCopy() *SnoozeBehavior {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SleepBehavior) DeepCopyInto(out *SleepBehavior) {
+	*out = *in
+	in.SnoozeBehavior.DeepCopyInto(&out.SnoozeBehavior)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SleepBehavior.
+func (in *SleepBehavior) DeepCopy() *SleepBehavior {
+	if in == nil {
+		return nil
+	}
+	out := new(SleepBehavior)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeSnoozeSpec) DeepCopyInto(out *KubeSnoozeSpec) {
 	*out = *in
 	in.Selector.DeepCopyInto(&out.Selector)
+	if in.RunnerPodTemplate != nil {
+		in, out := &in.RunnerPodTemplate, &out.RunnerPodTemplate
+		*out = new(RunnerPodTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StartingDeadlineSeconds != nil {
+		in, out := &in.StartingDeadlineSeconds, &out.StartingDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SuccessfulJobsHistoryLimit != nil {
+		in, out := &in.SuccessfulJobsHistoryLimit, &out.SuccessfulJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedJobsHistoryLimit != nil {
+		in, out := &in.FailedJobsHistoryLimit, &out.FailedJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
 	in.Sleep.DeepCopyInto(&out.Sleep)
 	in.Wake.DeepCopyInto(&out.Wake)
+	if in.SplashRoutes != nil {
+		in, out := &in.SplashRoutes, &out.SplashRoutes
+		*out = make([]SplashRoute, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeSnoozeSpec.
@@ -72,11 +129,22 @@ func (in *KubeSnoozeStatus) DeepCopyInto(out *KubeSnoozeStatus) {
 		in, out := &in.LastWakeTime, &out.LastWakeTime
 		*out = (*in).DeepCopy()
 	}
+	if in.LastSleepCatchUpTime != nil {
+		in, out := &in.LastSleepCatchUpTime, &out.LastSleepCatchUpTime
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
 		copy(*out, *in)
 	}
+	if in.WakeHistory != nil {
+		in, out := &in.WakeHistory, &out.WakeHistory
+		*out = make([]WakeRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeSnoozeStatus.
@@ -147,3 +215,112 @@ func (in *KubeSnoozeList) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerPodTemplate) DeepCopyInto(out *RunnerPodTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(v1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodSecurityContext != nil {
+		in, out := &in.PodSecurityContext, &out.PodSecurityContext
+		*out = new(v1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerPodTemplate.
+func (in *RunnerPodTemplate) DeepCopy() *RunnerPodTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerPodTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SplashRoute) DeepCopyInto(out *SplashRoute) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SplashRoute.
+func (in *SplashRoute) DeepCopy() *SplashRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(SplashRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WakeRecord) DeepCopyInto(out *WakeRecord) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Selectors != nil {
+		in, out := &in.Selectors, &out.Selectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WakeRecord.
+func (in *WakeRecord) DeepCopy() *WakeRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(WakeRecord)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -16,3 +16,11 @@ app.kubernetes.io/part-of: kubesnooze
 app.kubernetes.io/name: {{ include "kubesnooze-splash.name" . }}
 app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end -}}
+
+{{- define "kubesnooze-splash.serviceAccountName" -}}
+{{- if .Values.splash.serviceAccountName -}}
+{{- .Values.splash.serviceAccountName -}}
+{{- else -}}
+{{- include "kubesnooze-splash.fullname" . -}}
+{{- end -}}
+{{- end -}}
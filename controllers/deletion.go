@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	engine "kubesnooze/pkg/snooze"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// wakeOnDeleteFinalizer holds a KubeSnooze with deletionPolicy Wake until its
+// workloads are woken. The runner RBAC and snapshot ConfigMap carry it too, so
+// a foreground deletion cannot remove them before the wake has run.
+const wakeOnDeleteFinalizer = "kubesnooze.io/wake-on-delete"
+
+// wakeOnDeletePoll is how often a deleting KubeSnooze checks its wake Job,
+// which it does not own.
+const wakeOnDeletePoll = 10 * time.Second
+
+// ensureFinalizer adds the finalizer when deletion should wake the workloads,
+// and drops it when it should not.
+func (r *KubeSnoozeReconciler) ensureFinalizer(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze) error {
+	var changed bool
+	if snooze.Spec.DeletionPolicy == kubesnoozev1alpha1.DeletionPolicyWake {
+		changed = controllerutil.AddFinalizer(snooze, wakeOnDeleteFinalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(snooze, wakeOnDeleteFinalizer)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Update(ctx, snooze)
+}
+
+// finalize wakes the workloads of a KubeSnooze being deleted, then releases it
+// and the objects its wake needed. Owned objects are left to garbage
+// collection.
+func (r *KubeSnoozeReconciler) finalize(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(snooze, wakeOnDeleteFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	// Stop the schedules first, so a sleep cannot undo the wake.
+	if err := r.pruneCronJobs(ctx, snooze); err != nil {
+		return ctrl.Result{}, err
+	}
+	done, err := r.wakeOnDelete(ctx, snooze)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !done {
+		result := ctrl.Result{RequeueAfter: wakeOnDeletePoll}
+		if meta.SetStatusCondition(&snooze.Status.Conditions, metav1.Condition{
+			Type:    "Deleting",
+			Status:  metav1.ConditionTrue,
+			Reason:  "Waking",
+			Message: "waking the workloads before the KubeSnooze is deleted",
+		}) {
+			return result, r.Status().Update(ctx, snooze)
+		}
+		return result, nil
+	}
+
+	if err := r.releaseFinalizer(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: engine.SnapshotConfigMapName(snooze.Name), Namespace: snooze.Namespace}}); err != nil {
+		return ctrl.Result{}, err
+	}
+	hold, err := r.holdsRunnerRBAC(ctx, snooze.Namespace, snooze.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !hold {
+		for _, object := range []client.Object{&corev1.ServiceAccount{}, &rbacv1.Role{}, &rbacv1.RoleBinding{}} {
+			object.SetName(runnerServiceAccountName)
+			object.SetNamespace(snooze.Namespace)
+			if err := r.releaseFinalizer(ctx, object); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	controllerutil.RemoveFinalizer(snooze, wakeOnDeleteFinalizer)
+	return ctrl.Result{}, r.Update(ctx, snooze)
+}
+
+// holdsRunnerRBAC reports whether a KubeSnooze in the namespace other than
+// except may still wake on delete, and so needs the runner RBAC to outlive a
+// foreground deletion.
+func (r *KubeSnoozeReconciler) holdsRunnerRBAC(ctx context.Context, namespace, except string) (bool, error) {
+	var snoozes kubesnoozev1alpha1.KubeSnoozeList
+	if err := r.List(ctx, &snoozes, client.InNamespace(namespace)); err != nil {
+		return false, err
+	}
+	for i := range snoozes.Items {
+		if snoozes.Items[i].Name != except && controllerutil.ContainsFinalizer(&snoozes.Items[i], wakeOnDeleteFinalizer) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setWakeFinalizer adds or removes the wake-on-delete finalizer on an object a
+// wake on delete needs.
+func setWakeFinalizer(object client.Object, hold bool) {
+	if hold {
+		controllerutil.AddFinalizer(object, wakeOnDeleteFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(object, wakeOnDeleteFinalizer)
+	}
+}
+
+// releaseFinalizer removes the wake-on-delete finalizer from an object, so
+// garbage collection can take it.
+func (r *KubeSnoozeReconciler) releaseFinalizer(ctx context.Context, object client.Object) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !controllerutil.RemoveFinalizer(object, wakeOnDeleteFinalizer) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Update(ctx, object))
+}
+
+// wakeOnDelete runs a wake Job for the KubeSnooze and reports whether it is
+// finished. A failed wake does not block the deletion for good; it is logged.
+func (r *KubeSnoozeReconciler) wakeOnDelete(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	selector, err := metav1.LabelSelectorAsSelector(&snooze.Spec.Selector)
+	if err != nil {
+		logger.Info("cannot wake on delete", "error", err.Error())
+		return true, nil
+	}
+
+	job, err := r.runWakeJob(ctx, snooze, selector, fmt.Sprintf("kubesnooze-%s-wake-on-delete", snooze.Name), false)
+	if errors.HasStatusCause(err, corev1.NamespaceTerminatingCause) {
+		// The workloads are going away with the namespace.
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	finished := jobFinished(job)
+	if finished == nil {
+		return false, nil
+	}
+	if finished.Type == batchv1.JobFailed {
+		logger.Info("wake on delete failed; workloads may still be asleep", "job", job.Name, "reason", finished.Reason, "message", finished.Message)
+	}
+	return true, nil
+}
+
+// pruneCronJobs deletes the KubeSnooze's CronJobs for actions other than keep,
+// e.g. the wake CronJob once wakeCron is cleared.
+func (r *KubeSnoozeReconciler) pruneCronJobs(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze, keep ...string) error {
+	var cronJobs batchv1.CronJobList
+	if err := r.List(ctx, &cronJobs, client.InNamespace(snooze.Namespace), client.MatchingLabels{"kubesnooze.io/name": snooze.Name}); err != nil {
+		return err
+	}
+	for i := range cronJobs.Items {
+		cronJob := &cronJobs.Items[i]
+		if !metav1.IsControlledBy(cronJob, snooze) || slices.Contains(keep, cronJob.Labels["kubesnooze.io/action"]) {
+			continue
+		}
+		if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("deleted CronJob", "cronJob", cronJob.Name)
+	}
+	return nil
+}
+
+// pruneOrphans deletes what a deleted KubeSnooze left behind without an owner,
+// e.g. after `kubectl delete --cascade=orphan`: its CronJobs and snapshot
+// ConfigMap, and the runner RBAC once no other KubeSnooze owns it. Objects
+// that still have an owner are left to garbage collection.
+func (r *KubeSnoozeReconciler) pruneOrphans(ctx context.Context, key client.ObjectKey) error {
+	var cronJobs batchv1.CronJobList
+	if err := r.List(ctx, &cronJobs, client.InNamespace(key.Namespace), client.MatchingLabels{"kubesnooze.io/name": key.Name}); err != nil {
+		return err
+	}
+	orphans := make([]client.Object, 0, len(cronJobs.Items)+4)
+	for i := range cronJobs.Items {
+		orphans = append(orphans, &cronJobs.Items[i])
+	}
+	orphans = append(orphans,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: engine.SnapshotConfigMapName(key.Name), Namespace: key.Namespace}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: runnerServiceAccountName, Namespace: key.Namespace}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: runnerServiceAccountName, Namespace: key.Namespace}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: runnerServiceAccountName, Namespace: key.Namespace}},
+	)
+	for _, object := range orphans {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if len(object.GetOwnerReferences()) > 0 {
+			continue
+		}
+		if err := r.Delete(ctx, object, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		gvk, _ := apiutil.GVKForObject(object, r.Scheme)
+		log.FromContext(ctx).Info("deleted orphaned object", "kind", gvk.Kind, "name", object.GetName())
+	}
+	return nil
+}
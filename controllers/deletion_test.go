@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestReconciler(t *testing.T, objects ...client.Object) *KubeSnoozeReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubesnoozev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&kubesnoozev1alpha1.KubeSnooze{}).
+		Build()
+	return &KubeSnoozeReconciler{Client: c, Scheme: scheme}
+}
+
+func reconcileSnooze(t *testing.T, r *KubeSnoozeReconciler, key client.ObjectKey) {
+	t.Helper()
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+}
+
+func testSnooze() *kubesnoozev1alpha1.KubeSnooze {
+	return &kubesnoozev1alpha1.KubeSnooze{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dev"},
+		Spec: kubesnoozev1alpha1.KubeSnoozeSpec{
+			Selector:  metav1.LabelSelector{MatchLabels: map[string]string{"kubesnooze.io/snooze": "app"}},
+			SleepCron: "0 20 * * *",
+			WakeCron:  "0 7 * * *",
+		},
+	}
+}
+
+func TestReconcilePrunesWakeCronJob(t *testing.T) {
+	ctx := context.Background()
+	r := newTestReconciler(t, testSnooze())
+	key := client.ObjectKey{Namespace: "dev", Name: "app"}
+	reconcileSnooze(t, r, key)
+
+	wakeKey := client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-wake"}
+	if err := r.Get(ctx, wakeKey, &batchv1.CronJob{}); err != nil {
+		t.Fatalf("wake CronJob: %v", err)
+	}
+
+	var snooze kubesnoozev1alpha1.KubeSnooze
+	if err := r.Get(ctx, key, &snooze); err != nil {
+		t.Fatal(err)
+	}
+	snooze.Spec.WakeCron = ""
+	if err := r.Update(ctx, &snooze); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, key)
+
+	if err := r.Get(ctx, wakeKey, &batchv1.CronJob{}); !errors.IsNotFound(err) {
+		t.Errorf("wake CronJob after clearing wakeCron: %v, want not found", err)
+	}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-sleep"}, &batchv1.CronJob{}); err != nil {
+		t.Errorf("sleep CronJob: %v", err)
+	}
+}
+
+func TestReconcileWakesOnDelete(t *testing.T) {
+	ctx := context.Background()
+	snooze := testSnooze()
+	snooze.Spec.DeletionPolicy = kubesnoozev1alpha1.DeletionPolicyWake
+	r := newTestReconciler(t, snooze)
+	key := client.ObjectKey{Namespace: "dev", Name: "app"}
+	reconcileSnooze(t, r, key)
+
+	if err := r.Get(ctx, key, snooze); err != nil {
+		t.Fatal(err)
+	}
+	if len(snooze.Finalizers) != 1 || snooze.Finalizers[0] != wakeOnDeleteFinalizer {
+		t.Fatalf("finalizers = %v, want %s", snooze.Finalizers, wakeOnDeleteFinalizer)
+	}
+	if err := r.Delete(ctx, snooze); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, key)
+
+	// The schedules stop and a wake Job holds the KubeSnooze back.
+	var cronJobs batchv1.CronJobList
+	if err := r.List(ctx, &cronJobs, client.InNamespace("dev")); err != nil {
+		t.Fatal(err)
+	}
+	if len(cronJobs.Items) != 0 {
+		t.Errorf("CronJobs = %d, want none while deleting", len(cronJobs.Items))
+	}
+	var job batchv1.Job
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-wake-on-delete"}, &job); err != nil {
+		t.Fatalf("wake Job: %v", err)
+	}
+	if env := job.Spec.Template.Spec.Containers[0].Env[0]; env.Value != "wake" {
+		t.Errorf("runner action = %s, want wake", env.Value)
+	}
+	reconcileSnooze(t, r, key)
+	if err := r.Get(ctx, key, snooze); err != nil {
+		t.Fatalf("KubeSnooze released before the wake finished: %v", err)
+	}
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	if err := r.Status().Update(ctx, &job); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, key)
+	if err := r.Get(ctx, key, snooze); !errors.IsNotFound(err) {
+		t.Errorf("KubeSnooze after the wake: %v, want deleted", err)
+	}
+}
+
+func TestReconcilePrunesOrphans(t *testing.T) {
+	ctx := context.Background()
+	app := testSnooze()
+	app.UID = "app-uid"
+	other := testSnooze()
+	other.Name, other.UID = "other", "other-uid"
+	r := newTestReconciler(t, app, other)
+	reconcileSnooze(t, r, client.ObjectKeyFromObject(app))
+	reconcileSnooze(t, r, client.ObjectKeyFromObject(other))
+
+	// kubectl delete --cascade=orphan: the owner references go, the objects stay.
+	orphan := func(snooze *kubesnoozev1alpha1.KubeSnooze) {
+		t.Helper()
+		if err := r.Delete(ctx, snooze); err != nil {
+			t.Fatal(err)
+		}
+		lists := []client.ObjectList{&batchv1.CronJobList{}, &corev1.ConfigMapList{}, &corev1.ServiceAccountList{}, &rbacv1.RoleList{}, &rbacv1.RoleBindingList{}}
+		for _, list := range lists {
+			if err := r.List(ctx, list, client.InNamespace("dev")); err != nil {
+				t.Fatal(err)
+			}
+			if err := meta.EachListItem(list, func(item runtime.Object) error {
+				object := item.(client.Object)
+				var owners []metav1.OwnerReference
+				for _, owner := range object.GetOwnerReferences() {
+					if owner.UID != snooze.UID {
+						owners = append(owners, owner)
+					}
+				}
+				object.SetOwnerReferences(owners)
+				return r.Update(ctx, object)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reconcileSnooze(t, r, client.ObjectKeyFromObject(snooze))
+	}
+
+	orphan(app)
+	for _, name := range []string{"kubesnooze-app-sleep", "kubesnooze-app-wake"} {
+		if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: name}, &batchv1.CronJob{}); !errors.IsNotFound(err) {
+			t.Errorf("CronJob %s: %v, want deleted", name, err)
+		}
+	}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-snapshot"}, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("snapshot ConfigMap: %v, want deleted", err)
+	}
+	// The other KubeSnooze still owns the shared RBAC.
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: runnerServiceAccountName}, &rbacv1.Role{}); err != nil {
+		t.Errorf("runner Role: %v, want kept", err)
+	}
+
+	orphan(other)
+	for _, object := range []client.Object{&corev1.ServiceAccount{}, &rbacv1.Role{}, &rbacv1.RoleBinding{}} {
+		if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: runnerServiceAccountName}, object); !errors.IsNotFound(err) {
+			t.Errorf("runner %T: %v, want deleted", object, err)
+		}
+	}
+}
+
+func TestReconcileWakesOnForegroundDelete(t *testing.T) {
+	ctx := context.Background()
+	snooze := testSnooze()
+	snooze.UID = "app-uid"
+	snooze.Spec.DeletionPolicy = kubesnoozev1alpha1.DeletionPolicyWake
+	// A finished wake Job left by an earlier KubeSnooze of the same name.
+	stale := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubesnooze-app-wake-on-delete", Namespace: "dev", Annotations: map[string]string{annotationSnoozeUID: "old-uid"}},
+		Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+	}
+	r := newTestReconciler(t, snooze, stale)
+	key := client.ObjectKeyFromObject(snooze)
+	reconcileSnooze(t, r, key)
+
+	if err := r.Get(ctx, key, snooze); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(ctx, snooze, client.PropagationPolicy(metav1.DeletePropagationForeground)); err != nil {
+		t.Fatal(err)
+	}
+	// Foreground deletion removes the dependents before the wake can run.
+	needed := []client.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "kubesnooze-app-snapshot"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: runnerServiceAccountName}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: runnerServiceAccountName}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: runnerServiceAccountName}},
+	}
+	for _, object := range needed {
+		object.SetNamespace("dev")
+		if err := r.Delete(ctx, object); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reconcileSnooze(t, r, key)
+
+	var job batchv1.Job
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-wake-on-delete"}, &job); err != nil {
+		t.Fatalf("wake Job: %v", err)
+	}
+	if job.Annotations[annotationSnoozeUID] != "app-uid" || jobFinished(&job) != nil {
+		t.Errorf("wake Job = %+v, want a new one for this KubeSnooze", job.ObjectMeta)
+	}
+	if len(job.OwnerReferences) != 0 {
+		t.Errorf("wake Job owners = %v, want none so foreground deletion keeps it", job.OwnerReferences)
+	}
+	for _, object := range needed {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+			t.Errorf("%T %s during the wake: %v", object, object.GetName(), err)
+		}
+	}
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	if err := r.Status().Update(ctx, &job); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, key)
+	if err := r.Get(ctx, key, snooze); !errors.IsNotFound(err) {
+		t.Errorf("KubeSnooze after the wake: %v, want deleted", err)
+	}
+	for _, object := range needed {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(object), object); !errors.IsNotFound(err) {
+			t.Errorf("%T %s after the wake: %v, want released", object, object.GetName(), err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// startEnvtest runs an API server with the KubeSnooze CRD and returns a
+// reconciler talking to it. It skips the test unless KUBEBUILDER_ASSETS points
+// to the control plane binaries, e.g. from `setup-envtest use -p path`.
+func startEnvtest(t *testing.T) *KubeSnoozeReconciler {
+	t.Helper()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+	}
+	config, err := env.Start()
+	if err != nil {
+		t.Fatalf("start envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("stop envtest: %v", err)
+		}
+	})
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubesnoozev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &KubeSnoozeReconciler{Client: c, Scheme: scheme}
+}
+
+func TestEnvtestSeveralKubeSnoozesPerNamespace(t *testing.T) {
+	r := startEnvtest(t)
+	ctx := context.Background()
+	if err := r.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"web", "api", "jobs"}
+	for _, name := range names {
+		snooze := testSnooze()
+		snooze.Name = name
+		snooze.Spec.Selector.MatchLabels = map[string]string{"kubesnooze.io/snooze": name}
+		if err := r.Create(ctx, snooze); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+	// Each KubeSnooze reconciles cleanly, whichever came first.
+	for _, name := range names {
+		key := client.ObjectKey{Namespace: "dev", Name: name}
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("reconcile %s: %v", name, err)
+		}
+		for _, action := range []string{"sleep", "wake"} {
+			cronJobKey := client.ObjectKey{Namespace: "dev", Name: fmt.Sprintf("kubesnooze-%s-%s", name, action)}
+			if err := r.Get(ctx, cronJobKey, &batchv1.CronJob{}); err != nil {
+				t.Errorf("%s CronJob of %s: %v", action, name, err)
+			}
+		}
+	}
+
+	rbacKey := client.ObjectKey{Namespace: "dev", Name: runnerServiceAccountName}
+	for _, object := range []client.Object{&corev1.ServiceAccount{}, &rbacv1.Role{}, &rbacv1.RoleBinding{}} {
+		if err := r.Get(ctx, rbacKey, object); err != nil {
+			t.Fatalf("%T: %v", object, err)
+		}
+		if owners := object.GetOwnerReferences(); len(owners) != len(names) {
+			t.Errorf("%T owners = %+v, want one per KubeSnooze", object, owners)
+		}
+		if controller := metav1.GetControllerOfNoCopy(object); controller != nil {
+			t.Errorf("%T is controlled by %s, want no controller", object, controller.Name)
+		}
+	}
+
+	// envtest runs no garbage collector, so deleting a KubeSnooze leaves its
+	// reference behind; reconciling the others must still succeed.
+	if err := r.Delete(ctx, &kubesnoozev1alpha1.KubeSnooze{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: names[0]}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names[1:] {
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "dev", Name: name}}); err != nil {
+			t.Errorf("reconcile %s after deleting %s: %v", name, names[0], err)
+		}
+	}
+}
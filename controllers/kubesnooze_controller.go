@@ -3,12 +3,13 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"time"
 
 	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	engine "kubesnooze/pkg/snooze"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -22,7 +23,7 @@ import (
 )
 
 const (
-	defaultRunnerImage = "ghcr.io/kubesnooze/kubesnooze-runner:latest"
+	defaultRunnerImage       = "ghcr.io/kubesnooze/kubesnooze-runner:latest"
 	runnerServiceAccountName = "kubesnooze-runner"
 )
 
@@ -36,8 +37,12 @@ type KubeSnoozeReconciler struct {
 //+kubebuilder:rbac:groups=kubesnooze.io,resources=kubesnoozes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=kubesnooze.io,resources=kubesnoozes/finalizers,verbs=update
 //+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 
 func (r *KubeSnoozeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -45,7 +50,11 @@ func (r *KubeSnoozeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	var snooze kubesnoozev1alpha1.KubeSnooze
 	if err := r.Get(ctx, req.NamespacedName, &snooze); err != nil {
 		if errors.IsNotFound(err) {
-			return ctrl.Result{}, nil
+			if err := r.pruneOrphans(ctx, req.NamespacedName); err != nil {
+				return ctrl.Result{}, err
+			}
+			// The remaining KubeSnoozes may need less of the shared runner Role.
+			return ctrl.Result{}, r.refreshRunnerRole(ctx, req.Namespace)
 		}
 		return ctrl.Result{}, err
 	}
@@ -56,6 +65,13 @@ func (r *KubeSnoozeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	if !snooze.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, &snooze)
+	}
+	if err := r.ensureFinalizer(ctx, &snooze); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	selector, err := metav1.LabelSelectorAsSelector(&snooze.Spec.Selector)
 	if err != nil {
 		meta.SetStatusCondition(&snooze.Status.Conditions, metav1.Condition{
@@ -73,102 +89,131 @@ func (r *KubeSnoozeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	if err := r.ensureCronJob(ctx, &snooze, "sleep", snooze.Spec.SleepCron, selector); err != nil {
+	// The runner records pre-sleep state here; the owner reference lets GC remove it.
+	if err := r.ensureSnapshotConfigMap(ctx, &snooze); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// Hold the sleep CronJob back while a postponement is active.
+	postponedUntil, err := postponement(&snooze, time.Now())
+	if err != nil {
+		logger.Info("ignoring invalid postponement", "annotation", kubesnoozev1alpha1.AnnotationPostponeUntil, "error", err.Error())
+	}
+
+	suspended := snooze.Spec.Suspend
+	sleepCronJob, err := r.ensureCronJob(ctx, &snooze, "sleep", snooze.Spec.SleepCron, selector, suspended || !postponedUntil.IsZero())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	actions := []string{"sleep"}
 	if snooze.Spec.WakeCron != "" {
-		if err := r.ensureCronJob(ctx, &snooze, "wake", snooze.Spec.WakeCron, selector); err != nil {
+		if _, err := r.ensureCronJob(ctx, &snooze, "wake", snooze.Spec.WakeCron, selector, suspended); err != nil {
 			return ctrl.Result{}, err
 		}
+		actions = append(actions, "wake")
+	}
+	if err := r.pruneCronJobs(ctx, &snooze, actions...); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileSuspend(ctx, &snooze, selector); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{}
+	if postponedUntil.IsZero() && !suspended {
+		// Run a sleep the CronJob missed, e.g. while the cluster's controllers
+		// were down or a postponement held it back past its deadline.
+		now := time.Now()
+		scheduled, err := missedSleep(&snooze, sleepCronJob, now)
+		if err != nil {
+			logger.Info("cannot check for a missed sleep", "error", err.Error())
+		} else if !scheduled.IsZero() {
+			logger.Info("catching up a missed sleep", "scheduled", scheduled.Format(time.RFC3339))
+			if err := r.catchUpSleep(ctx, sleepCronJob, scheduled); err != nil {
+				return ctrl.Result{}, err
+			}
+			snooze.Status.LastSleepCatchUpTime = &metav1.Time{Time: scheduled}
+		}
+		if next := nextCatchUpCheck(&snooze, sleepCronJob, now); !next.IsZero() {
+			result.RequeueAfter = next.Sub(now)
+		}
+	}
+	if postponedUntil.IsZero() {
+		meta.RemoveStatusCondition(&snooze.Status.Conditions, "Postponed")
+	} else {
+		meta.SetStatusCondition(&snooze.Status.Conditions, metav1.Condition{
+			Type:    "Postponed",
+			Status:  metav1.ConditionTrue,
+			Reason:  "PostponeAnnotation",
+			Message: fmt.Sprintf("sleep postponed until %s", postponedUntil.Format(time.RFC3339)),
+		})
+		// Come back when it ends to release the CronJob.
+		result.RequeueAfter = time.Until(postponedUntil)
 	}
 
 	snooze.Status.ObservedGeneration = snooze.Generation
+	message := "CronJobs are configured"
+	if suspended {
+		message = "CronJobs are configured and suspended"
+	}
 	meta.SetStatusCondition(&snooze.Status.Conditions, metav1.Condition{
 		Type:    "Ready",
 		Status:  metav1.ConditionTrue,
 		Reason:  "Reconciled",
-		Message: "CronJobs are configured",
+		Message: message,
 	})
 	if err := r.Status().Update(ctx, &snooze); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return result, nil
 }
 
-// ensureRBAC wires a ServiceAccount, Role, and RoleBinding for the runner.
-func (r *KubeSnoozeReconciler) ensureRBAC(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze) error {
-	serviceAccount := &corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      runnerServiceAccountName,
-			Namespace: snooze.Namespace,
-		},
+// postponement returns when an active postponement ends, or the zero time if
+// there is none or it has already passed.
+func postponement(snooze *kubesnoozev1alpha1.KubeSnooze, now time.Time) (time.Time, error) {
+	raw, ok := snooze.Annotations[kubesnoozev1alpha1.AnnotationPostponeUntil]
+	if !ok || raw == "" {
+		return time.Time{}, nil
 	}
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, serviceAccount, func() error {
-		return controllerutil.SetControllerReference(snooze, serviceAccount, r.Scheme)
-	}); err != nil {
-		return err
-	}
-
-	role := &rbacv1.Role{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "kubesnooze-runner",
-			Namespace: snooze.Namespace,
-		},
+	until, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, err
 	}
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, role, func() error {
-		role.Rules = []rbacv1.PolicyRule{
-			{
-				APIGroups: []string{"apps"},
-				Resources: []string{"deployments", "statefulsets"},
-				Verbs:     []string{"get", "list", "watch", "update", "patch"},
-			},
-			{
-				APIGroups: []string{"autoscaling"},
-				Resources: []string{"horizontalpodautoscalers"},
-				Verbs:     []string{"get", "list", "watch", "update", "patch"},
-			},
-			{
-				APIGroups: []string{"batch"},
-				Resources: []string{"cronjobs"},
-				Verbs:     []string{"get", "list", "watch", "update", "patch"},
-			},
-		}
-		return controllerutil.SetControllerReference(snooze, role, r.Scheme)
-	}); err != nil {
-		return err
+	if !until.After(now) {
+		return time.Time{}, nil
 	}
+	return until, nil
+}
 
-	roleBinding := &rbacv1.RoleBinding{
+// ensureSnapshotConfigMap creates the ConfigMap the runner fills with the
+// pre-sleep state of every object it touches. Data is owned by the runner and
+// left alone here.
+func (r *KubeSnoozeReconciler) ensureSnapshotConfigMap(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze) error {
+	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "kubesnooze-runner",
+			Name:      engine.SnapshotConfigMapName(snooze.Name),
 			Namespace: snooze.Namespace,
 		},
 	}
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, roleBinding, func() error {
-		roleBinding.RoleRef = rbacv1.RoleRef{
-			APIGroup: rbacv1.GroupName,
-			Kind:     "Role",
-			Name:     role.Name,
-		}
-		roleBinding.Subjects = []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      serviceAccount.Name,
-				Namespace: snooze.Namespace,
-			},
-		}
-		return controllerutil.SetControllerReference(snooze, roleBinding, r.Scheme)
-	}); err != nil {
-		return err
-	}
-
-	return nil
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, configMap, func() error {
+		configMap.Labels = mergeLabels(configMap.Labels, map[string]string{
+			"app.kubernetes.io/name":    "kubesnooze",
+			"app.kubernetes.io/part-of": "kubesnooze",
+			"kubesnooze.io/name":        snooze.Name,
+		})
+		setWakeFinalizer(configMap, controllerutil.ContainsFinalizer(snooze, wakeOnDeleteFinalizer))
+		return controllerutil.SetControllerReference(snooze, configMap, r.Scheme)
+	})
+	return err
 }
 
 // ensureCronJob creates or updates the CronJob that triggers the runner.
-func (r *KubeSnoozeReconciler) ensureCronJob(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze, action string, schedule string, selector labels.Selector) error {
+// A suspended CronJob runs its most recent missed schedule once resumed, if
+// still within the starting deadline; later sleeps are caught up by Reconcile.
+func (r *KubeSnoozeReconciler) ensureCronJob(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze, action string, schedule string, selector labels.Selector, suspend bool) (*batchv1.CronJob, error) {
 	cronJob := &batchv1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("kubesnooze-%s-%s", snooze.Name, action),
@@ -178,10 +223,10 @@ func (r *KubeSnoozeReconciler) ensureCronJob(ctx context.Context, snooze *kubesn
 
 	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, cronJob, func() error {
 		labelsMap := map[string]string{
-			"app.kubernetes.io/name": "kubesnooze",
+			"app.kubernetes.io/name":    "kubesnooze",
 			"app.kubernetes.io/part-of": "kubesnooze",
-			"kubesnooze.io/name": snooze.Name,
-			"kubesnooze.io/action": action,
+			"kubesnooze.io/name":        snooze.Name,
+			"kubesnooze.io/action":      action,
 		}
 		cronJob.Labels = mergeLabels(cronJob.Labels, labelsMap)
 		cronJob.Spec.Schedule = schedule
@@ -191,37 +236,12 @@ func (r *KubeSnoozeReconciler) ensureCronJob(ctx context.Context, snooze *kubesn
 			cronJob.Spec.TimeZone = nil
 		}
 		cronJob.Spec.ConcurrencyPolicy = batchv1.ForbidConcurrent
-		cronJob.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName = runnerServiceAccountName
-		cronJob.Spec.JobTemplate.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
-
-		image := snooze.Spec.RunnerImage
-		if image == "" {
-			image = defaultRunnerImage
-		}
-
-		// Pass the resolved action and settings to the runner container.
-		env := []corev1.EnvVar{
-			{Name: "KUBESNOOZE_ACTION", Value: action},
-			{Name: "KUBESNOOZE_NAMESPACE", Value: snooze.Namespace},
-			{Name: "KUBESNOOZE_LABEL_SELECTOR", Value: selector.String()},
-			{Name: "KUBESNOOZE_SLEEP_REPLICAS", Value: int32String(snooze.Spec.Sleep.Replicas)},
-			{Name: "KUBESNOOZE_WAKE_REPLICAS", Value: int32String(snooze.Spec.Wake.Replicas)},
-			{Name: "KUBESNOOZE_SLEEP_HPA_MIN_REPLICAS", Value: int32String(snooze.Spec.Sleep.HPAMinReplicas)},
-			{Name: "KUBESNOOZE_WAKE_HPA_MIN_REPLICAS", Value: int32String(snooze.Spec.Wake.HPAMinReplicas)},
-			{Name: "KUBESNOOZE_SLEEP_SUSPEND_CRONJOBS", Value: boolString(snooze.Spec.Sleep.SuspendCronJobs, true)},
-			{Name: "KUBESNOOZE_WAKE_SUSPEND_CRONJOBS", Value: boolString(snooze.Spec.Wake.SuspendCronJobs, false)},
-		}
-
-		cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers = []corev1.Container{
-			{
-				Name:  "kubesnooze-runner",
-				Image: image,
-				Env:   env,
-			},
-		}
+		cronJob.Spec.Suspend = ptr.To(suspend)
+		applyCronJobSettings(cronJob, &snooze.Spec)
+		applyRunnerJob(&cronJob.Spec.JobTemplate.Spec, snooze, action, selector, labelsMap)
 		return controllerutil.SetControllerReference(snooze, cronJob, r.Scheme)
 	})
-	return err
+	return cronJob, err
 }
 
 func int32String(value *int32) string {
@@ -253,5 +273,8 @@ func (r *KubeSnoozeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubesnoozev1alpha1.KubeSnooze{}).
 		Owns(&batchv1.CronJob{}).
+		Owns(&batchv1.Job{}).
+		// The snapshot ConfigMap is not watched: the runner rewrites it on every
+		// run, and a deleted one is recreated on the next reconcile.
 		Complete(r)
 }
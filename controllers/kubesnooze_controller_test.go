@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileSharesRunnerRBAC(t *testing.T) {
+	ctx := context.Background()
+	first, second := testSnooze(), testSnooze()
+	first.UID, second.Name, second.UID = "first-uid", "api", "second-uid"
+	r := newTestReconciler(t, first, second)
+	reconcileSnooze(t, r, client.ObjectKeyFromObject(first))
+	reconcileSnooze(t, r, client.ObjectKeyFromObject(second))
+
+	key := client.ObjectKey{Namespace: "dev", Name: runnerServiceAccountName}
+	for _, object := range []client.Object{&corev1.ServiceAccount{}, &rbacv1.Role{}, &rbacv1.RoleBinding{}} {
+		if err := r.Get(ctx, key, object); err != nil {
+			t.Fatalf("%T: %v", object, err)
+		}
+		owners := object.GetOwnerReferences()
+		if len(owners) != 2 || owners[0].UID != first.UID || owners[1].UID != second.UID {
+			t.Errorf("%T owners = %+v, want both KubeSnoozes", object, owners)
+		}
+		if controller := metav1.GetControllerOfNoCopy(object); controller != nil {
+			t.Errorf("%T is controlled by %s, want no controller", object, controller.Name)
+		}
+	}
+}
+
+func TestReconcileReleasesControllerReference(t *testing.T) {
+	ctx := context.Background()
+	snooze := testSnooze()
+	snooze.UID = "snooze-uid"
+	// Runner RBAC created by earlier versions is controlled by one KubeSnooze.
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:      runnerServiceAccountName,
+		Namespace: "dev",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "kubesnooze.io/v1alpha1",
+			Kind:       "KubeSnooze",
+			Name:       snooze.Name,
+			UID:        snooze.UID,
+			Controller: ptr.To(true),
+		}},
+	}}
+	r := newTestReconciler(t, snooze, serviceAccount)
+	reconcileSnooze(t, r, client.ObjectKeyFromObject(snooze))
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(serviceAccount), serviceAccount); err != nil {
+		t.Fatal(err)
+	}
+	if owners := serviceAccount.OwnerReferences; len(owners) != 1 || metav1.GetControllerOfNoCopy(serviceAccount) != nil {
+		t.Errorf("owners = %+v, want one non-controller reference", owners)
+	}
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	engine "kubesnooze/pkg/snooze"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ensureRBAC wires a ServiceAccount, Role, and RoleBinding for the runner.
+// They are shared by every KubeSnooze in the namespace. Each KubeSnooze adds a non-controller owner
+// reference, so garbage collection removes them with the last KubeSnooze.
+func (r *KubeSnoozeReconciler) ensureRBAC(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze) error {
+	// The snooze's own finalizer may not be in the cache yet.
+	hold, err := r.holdsRunnerRBAC(ctx, snooze.Namespace, snooze.Name)
+	if err != nil {
+		return err
+	}
+	hold = hold || controllerutil.ContainsFinalizer(snooze, wakeOnDeleteFinalizer)
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      runnerServiceAccountName,
+			Namespace: snooze.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, serviceAccount, func() error {
+		setWakeFinalizer(serviceAccount, hold)
+		return controllerutil.SetOwnerReference(snooze, serviceAccount, r.Scheme)
+	}); err != nil {
+		return err
+	}
+
+	rules, err := r.runnerRules(ctx, snooze.Namespace)
+	if err != nil {
+		return err
+	}
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      runnerServiceAccountName,
+			Namespace: snooze.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, role, func() error {
+		role.Rules = rules
+		setWakeFinalizer(role, hold)
+		return controllerutil.SetOwnerReference(snooze, role, r.Scheme)
+	}); err != nil {
+		return err
+	}
+
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      runnerServiceAccountName,
+			Namespace: snooze.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, roleBinding, func() error {
+		roleBinding.RoleRef = rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     role.Name,
+		}
+		roleBinding.Subjects = []rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      serviceAccount.Name,
+				Namespace: snooze.Namespace,
+			},
+		}
+		setWakeFinalizer(roleBinding, hold)
+		return controllerutil.SetOwnerReference(snooze, roleBinding, r.Scheme)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// refreshRunnerRole recomputes the rules of an existing runner Role, e.g.
+// after a KubeSnooze is gone and the others no longer need its objects.
+func (r *KubeSnoozeReconciler) refreshRunnerRole(ctx context.Context, namespace string) error {
+	role := &rbacv1.Role{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: runnerServiceAccountName}, role); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	rules, err := r.runnerRules(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(role.DeepCopy())
+	role.Rules = rules
+	return r.Patch(ctx, role, patch)
+}
+
+// runnerRules computes the Role for the runner Jobs of every KubeSnooze in
+// the namespace from what their specs enable. Workloads are granted by kind
+// rather than by name: runners pick them by label at run time, and objects
+// that start matching between reconciles must not fail the run. The snapshot
+// ConfigMaps and the KubeSnoozes' status have fixed names and stay named.
+func (r *KubeSnoozeReconciler) runnerRules(ctx context.Context, namespace string) ([]rbacv1.PolicyRule, error) {
+	var snoozes kubesnoozev1alpha1.KubeSnoozeList
+	if err := r.List(ctx, &snoozes, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	var (
+		names      []string
+		snapshots  []string
+		cronJobs   bool
+		createHPAs bool
+	)
+	for i := range snoozes.Items {
+		snooze := &snoozes.Items[i]
+		names = append(names, snooze.Name)
+		snapshots = append(snapshots, engine.SnapshotConfigMapName(snooze.Name))
+		cronJobs = cronJobs || engine.SuspendsCronJobs(snooze.Spec)
+		if !createHPAs {
+			restores, err := r.restoresHPAs(ctx, snooze)
+			if err != nil {
+				return nil, err
+			}
+			createHPAs = restores
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+	sort.Strings(snapshots)
+
+	hpaVerbs := []string{"get", "list", "watch", "update", "patch"}
+	if createHPAs {
+		hpaVerbs = append(hpaVerbs, "create", "delete")
+	}
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"apps"},
+			Resources: []string{"deployments", "statefulsets"},
+			Verbs:     []string{"get", "list", "watch", "update", "patch"},
+		},
+		{
+			APIGroups: []string{"autoscaling"},
+			Resources: []string{"horizontalpodautoscalers"},
+			Verbs:     hpaVerbs,
+		},
+	}
+	if cronJobs {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"batch"},
+			Resources: []string{"cronjobs"},
+			Verbs:     []string{"get", "list", "watch", "update", "patch"},
+		})
+	}
+	return append(rules,
+		rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: snapshots,
+			Verbs:         []string{"get", "update", "patch"},
+		},
+		rbacv1.PolicyRule{
+			// The runner reads its KubeSnooze before recording the run.
+			APIGroups:     []string{kubesnoozev1alpha1.GroupVersion.Group},
+			Resources:     []string{"kubesnoozes"},
+			ResourceNames: names,
+			Verbs:         []string{"get"},
+		},
+		rbacv1.PolicyRule{
+			// Sleeps and wakes are recorded in the status.
+			APIGroups:     []string{kubesnoozev1alpha1.GroupVersion.Group},
+			Resources:     []string{"kubesnoozes/status"},
+			ResourceNames: names,
+			Verbs:         []string{"get", "patch"},
+		},
+	), nil
+}
+
+// restoresHPAs reports whether runners of snooze delete or recreate HPAs:
+// it uses the Delete strategy, or its snapshot still holds HPAs that strategy
+// removed before the spec changed.
+func (r *KubeSnoozeReconciler) restoresHPAs(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze) (bool, error) {
+	if snooze.Spec.Sleep.HPAStrategy == engine.HPAStrategyDelete {
+		return true, nil
+	}
+	var snapshot corev1.ConfigMap
+	key := client.ObjectKey{Namespace: snooze.Namespace, Name: engine.SnapshotConfigMapName(snooze.Name)}
+	if err := r.Get(ctx, key, &snapshot); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return engine.HoldsHPASnapshot(&snapshot), nil
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	engine "kubesnooze/pkg/snooze"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ruleFor returns the rule granting resource, or nil.
+func ruleFor(rules []rbacv1.PolicyRule, resource string) *rbacv1.PolicyRule {
+	for i, rule := range rules {
+		for _, granted := range rule.Resources {
+			if granted == resource {
+				return &rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+func TestRunnerRulesFollowSpecs(t *testing.T) {
+	ctx := context.Background()
+	web := testSnooze()
+	web.Name = "web"
+	api := testSnooze()
+	api.Name = "api"
+	api.Spec.Sleep.SuspendCronJobs = ptr.To(false)
+	r := newTestReconciler(t, web, api)
+
+	rules, err := r.runnerRules(ctx, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Runners select workloads at run time, so they are granted by kind.
+	for _, resource := range []string{"deployments", "statefulsets", "horizontalpodautoscalers", "cronjobs"} {
+		rule := ruleFor(rules, resource)
+		if rule == nil || len(rule.ResourceNames) != 0 || !reflect.DeepEqual(rule.Verbs[len(rule.Verbs)-2:], []string{"update", "patch"}) {
+			t.Errorf("%s rule = %+v, want update and patch on every object", resource, rule)
+		}
+	}
+	if got := ruleFor(rules, "configmaps").ResourceNames; !reflect.DeepEqual(got, []string{"kubesnooze-api-snapshot", "kubesnooze-web-snapshot"}) {
+		t.Errorf("configmap names = %v", got)
+	}
+	for _, resource := range []string{"kubesnoozes", "kubesnoozes/status"} {
+		if got := ruleFor(rules, resource).ResourceNames; !reflect.DeepEqual(got, []string{"api", "web"}) {
+			t.Errorf("%s names = %v", resource, got)
+		}
+	}
+
+	// Deleting the only KubeSnooze that suspends CronJobs drops them.
+	reconcileSnooze(t, r, client.ObjectKeyFromObject(api))
+	if err := r.Delete(ctx, web); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, client.ObjectKeyFromObject(web))
+	var role rbacv1.Role
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: runnerServiceAccountName}, &role); err != nil {
+		t.Fatal(err)
+	}
+	if rule := ruleFor(role.Rules, "cronjobs"); rule != nil {
+		t.Errorf("cronjob rule = %+v, want none", rule)
+	}
+	if got := ruleFor(role.Rules, "kubesnoozes/status").ResourceNames; !reflect.DeepEqual(got, []string{"api"}) {
+		t.Errorf("status names after deleting web = %v", got)
+	}
+}
+
+// The runner skips CronJobs unless one of its suspend settings is true, so
+// the Role must grant CronJobs exactly when the runner Job asks for either.
+func TestRunnerRulesMatchCronJobEnv(t *testing.T) {
+	for _, tt := range []struct{ sleep, wake *bool }{
+		{nil, nil},
+		{ptr.To(false), nil},
+		{ptr.To(false), ptr.To(false)},
+		{ptr.To(false), ptr.To(true)},
+		{ptr.To(true), ptr.To(false)},
+	} {
+		snooze := testSnooze()
+		snooze.Spec.Sleep.SuspendCronJobs = tt.sleep
+		snooze.Spec.Wake.SuspendCronJobs = tt.wake
+		rules, err := newTestReconciler(t, snooze).runnerRules(context.Background(), "dev")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var job batchv1.JobSpec
+		applyRunnerJob(&job, snooze, "sleep", labels.Everything(), nil)
+		suspends := false
+		for _, env := range job.Template.Spec.Containers[0].Env {
+			if (env.Name == "KUBESNOOZE_SLEEP_SUSPEND_CRONJOBS" || env.Name == "KUBESNOOZE_WAKE_SUSPEND_CRONJOBS") && env.Value == "true" {
+				suspends = true
+			}
+		}
+		if granted := ruleFor(rules, "cronjobs") != nil; granted != suspends {
+			t.Errorf("sleep %v, wake %v: cronjobs granted = %t, runner suspends = %t", ptr.Deref(tt.sleep, true), ptr.Deref(tt.wake, false), granted, suspends)
+		}
+	}
+}
+
+func TestRunnerRulesHPADeleteStrategy(t *testing.T) {
+	ctx := context.Background()
+	canCreate := func(rules []rbacv1.PolicyRule) bool {
+		verbs := ruleFor(rules, "horizontalpodautoscalers").Verbs
+		return reflect.DeepEqual(verbs[len(verbs)-2:], []string{"create", "delete"})
+	}
+
+	snooze := testSnooze()
+	snooze.Spec.Sleep.HPAStrategy = engine.HPAStrategyDelete
+	rules, err := newTestReconciler(t, snooze).runnerRules(ctx, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canCreate(rules) {
+		t.Errorf("rules = %+v, want HPA create and delete", rules)
+	}
+
+	// Without the Delete strategy or snapshots, HPAs are never created.
+	snooze.Spec.Sleep.HPAStrategy = ""
+	if rules, err = newTestReconciler(t, snooze).runnerRules(ctx, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if canCreate(rules) {
+		t.Errorf("rules = %+v, want no HPA create", rules)
+	}
+
+	// An HPA removed before the strategy changed is still restored on wake.
+	snapshot := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: engine.SnapshotConfigMapName(snooze.Name), Namespace: "dev"},
+		Data: map[string]string{
+			"horizontalpodautoscaler.web": `{"kind":"HorizontalPodAutoscaler","name":"web","hpa":{"metadata":{"name":"web"}}}`,
+		},
+	}
+	if rules, err = newTestReconciler(t, snooze, snapshot).runnerRules(ctx, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if !canCreate(rules) {
+		t.Errorf("rules = %+v, want HPA create to restore the snapshot", rules)
+	}
+}
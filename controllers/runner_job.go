@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	"kubesnooze/pkg/cron"
+	engine "kubesnooze/pkg/snooze"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Runner Job defaults for unset KubeSnooze fields.
+const (
+	defaultStartingDeadlineSeconds    int64 = 300
+	defaultBackoffLimit               int32 = 2
+	defaultActiveDeadlineSeconds      int64 = 600
+	defaultTTLSecondsAfterFinished    int32 = 86400
+	defaultSuccessfulJobsHistoryLimit int32 = 1
+	defaultFailedJobsHistoryLimit     int32 = 3
+
+	// catchUpGrace leaves the CronJob controller time to start a Job at the
+	// very end of its deadline before a catch-up Job is created instead.
+	catchUpGrace = time.Minute
+
+	// annotationCatchUp marks Jobs created for a missed sleep.
+	annotationCatchUp = "kubesnooze.io/catch-up"
+	// annotationSnoozeUID marks the KubeSnooze an unowned wake Job is for.
+	annotationSnoozeUID = "kubesnooze.io/uid"
+)
+
+// applyCronJobSettings sets the starting deadline and history of a runner
+// CronJob from the KubeSnooze, or their defaults.
+func applyCronJobSettings(cronJob *batchv1.CronJob, spec *kubesnoozev1alpha1.KubeSnoozeSpec) {
+	cronJob.Spec.StartingDeadlineSeconds = ptr.To(ptr.Deref(spec.StartingDeadlineSeconds, defaultStartingDeadlineSeconds))
+	cronJob.Spec.SuccessfulJobsHistoryLimit = ptr.To(ptr.Deref(spec.SuccessfulJobsHistoryLimit, defaultSuccessfulJobsHistoryLimit))
+	cronJob.Spec.FailedJobsHistoryLimit = ptr.To(ptr.Deref(spec.FailedJobsHistoryLimit, defaultFailedJobsHistoryLimit))
+}
+
+// applyRunnerJob fills in a Job that runs action for the KubeSnooze, with its
+// deadlines and retries or their defaults. podLabels identify the runner pod.
+func applyRunnerJob(job *batchv1.JobSpec, snooze *kubesnoozev1alpha1.KubeSnooze, action string, selector labels.Selector, podLabels map[string]string) {
+	spec := &snooze.Spec
+	job.BackoffLimit = ptr.To(ptr.Deref(spec.BackoffLimit, defaultBackoffLimit))
+	job.ActiveDeadlineSeconds = ptr.To(ptr.Deref(spec.ActiveDeadlineSeconds, defaultActiveDeadlineSeconds))
+	job.TTLSecondsAfterFinished = ptr.To(ptr.Deref(spec.TTLSecondsAfterFinished, defaultTTLSecondsAfterFinished))
+
+	job.Template.Spec.ServiceAccountName = runnerServiceAccountName
+	job.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	image := spec.RunnerImage
+	if image == "" {
+		image = defaultRunnerImage
+	}
+
+	// Pass the resolved action and settings to the runner container.
+	env := []corev1.EnvVar{
+		{Name: "KUBESNOOZE_ACTION", Value: action},
+		{Name: "KUBESNOOZE_NAME", Value: snooze.Name},
+		{Name: "KUBESNOOZE_NAMESPACE", Value: snooze.Namespace},
+		{Name: "KUBESNOOZE_LABEL_SELECTOR", Value: selector.String()},
+		{Name: "KUBESNOOZE_SNAPSHOT_CONFIGMAP", Value: engine.SnapshotConfigMapName(snooze.Name)},
+		{Name: "KUBESNOOZE_SLEEP_REPLICAS", Value: int32String(spec.Sleep.Replicas)},
+		{Name: "KUBESNOOZE_WAKE_REPLICAS", Value: int32String(spec.Wake.Replicas)},
+		{Name: "KUBESNOOZE_SLEEP_HPA_MIN_REPLICAS", Value: int32String(spec.Sleep.HPAMinReplicas)},
+		{Name: "KUBESNOOZE_WAKE_HPA_MIN_REPLICAS", Value: int32String(spec.Wake.HPAMinReplicas)},
+		{Name: "KUBESNOOZE_SLEEP_HPA_STRATEGY", Value: spec.Sleep.HPAStrategy},
+		{Name: "KUBESNOOZE_SLEEP_SUSPEND_CRONJOBS", Value: boolString(spec.Sleep.SuspendCronJobs, true)},
+		{Name: "KUBESNOOZE_WAKE_SUSPEND_CRONJOBS", Value: boolString(spec.Wake.SuspendCronJobs, false)},
+	}
+
+	applyRunnerPodTemplate(&job.Template, corev1.Container{
+		Name:  "kubesnooze-runner",
+		Image: image,
+		Env:   env,
+	}, podLabels, spec.RunnerPodTemplate)
+}
+
+// startingDeadline is how late the CronJob controller still starts a Job.
+func startingDeadline(cronJob *batchv1.CronJob) time.Duration {
+	return time.Duration(ptr.Deref(cronJob.Spec.StartingDeadlineSeconds, defaultStartingDeadlineSeconds)) * time.Second
+}
+
+// scheduleLocation is the timezone the KubeSnooze's schedules run in.
+func scheduleLocation(snooze *kubesnoozev1alpha1.KubeSnooze) (*time.Location, error) {
+	if snooze.Spec.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(snooze.Spec.Timezone)
+}
+
+// missedSleep returns the latest scheduled sleep that the sleep CronJob did
+// not run and will no longer start, or the zero time. A sleep is not missed
+// if a wake is due or has run since, so catching up never undoes a wake.
+func missedSleep(snooze *kubesnoozev1alpha1.KubeSnooze, cronJob *batchv1.CronJob, now time.Time) (time.Time, error) {
+	loc, err := scheduleLocation(snooze)
+	if err != nil {
+		return time.Time{}, err
+	}
+	schedule, err := cron.Parse(snooze.Spec.SleepCron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	scheduled := schedule.Prev(now.In(loc))
+	if scheduled.IsZero() || now.Before(scheduled.Add(startingDeadline(cronJob)+catchUpGrace)) {
+		return time.Time{}, nil
+	}
+
+	if snooze.Spec.WakeCron != "" {
+		wakeSchedule, err := cron.Parse(snooze.Spec.WakeCron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !wakeSchedule.Prev(now.In(loc)).Before(scheduled) {
+			return time.Time{}, nil
+		}
+	}
+
+	// Schedules before the CronJob existed were never meant to run, and
+	// anything recorded at or after the schedule already covers it.
+	covered := []*metav1.Time{
+		&cronJob.CreationTimestamp,
+		cronJob.Status.LastScheduleTime,
+		snooze.Status.LastSleepTime,
+		snooze.Status.LastWakeTime,
+		snooze.Status.LastSleepCatchUpTime,
+	}
+	if suspended := meta.FindStatusCondition(snooze.Status.Conditions, "Suspended"); suspended != nil && suspended.Status == metav1.ConditionFalse {
+		// Sleeps are not caught up across a suspension.
+		covered = append(covered, &suspended.LastTransitionTime)
+	}
+	for _, at := range covered {
+		if at != nil && !at.Time.Before(scheduled) {
+			return time.Time{}, nil
+		}
+	}
+	if len(cronJob.Status.Active) > 0 {
+		return time.Time{}, nil
+	}
+	return scheduled, nil
+}
+
+// nextCatchUpCheck is when a sleep scheduled after now could first be missed.
+func nextCatchUpCheck(snooze *kubesnoozev1alpha1.KubeSnooze, cronJob *batchv1.CronJob, now time.Time) time.Time {
+	loc, err := scheduleLocation(snooze)
+	if err != nil {
+		return time.Time{}
+	}
+	schedule, err := cron.Parse(snooze.Spec.SleepCron)
+	if err != nil {
+		return time.Time{}
+	}
+	next := schedule.Next(now.In(loc))
+	if next.IsZero() {
+		return time.Time{}
+	}
+	return next.Add(startingDeadline(cronJob) + catchUpGrace)
+}
+
+// catchUpSleep runs the sleep CronJob's Job for a missed schedule. The Job is
+// named like the one the CronJob controller would have created, so only one of
+// them can exist.
+func (r *KubeSnoozeReconciler) catchUpSleep(ctx context.Context, cronJob *batchv1.CronJob, scheduled time.Time) error {
+	template := cronJob.Spec.JobTemplate.DeepCopy()
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%d", cronJob.Name, scheduled.Unix()/60),
+			Namespace:   cronJob.Namespace,
+			Labels:      template.Labels,
+			Annotations: mergeLabels(template.Annotations, map[string]string{annotationCatchUp: scheduled.UTC().Format(time.RFC3339)}),
+		},
+		Spec: template.Spec,
+	}
+	if err := controllerutil.SetControllerReference(cronJob, job, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// runWakeJob starts a one-off wake Job for the KubeSnooze under name, unless
+// it already exists, and returns the Job. An owned Job requeues the KubeSnooze
+// when it finishes; an unowned one survives a foreground deletion of it.
+func (r *KubeSnoozeReconciler) runWakeJob(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze, selector labels.Selector, name string, owned bool) (*batchv1.Job, error) {
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: snooze.Namespace, Name: name}, job)
+	if err == nil && !owned && job.Annotations[annotationSnoozeUID] != string(snooze.UID) {
+		// Left over from an earlier KubeSnooze of the same name.
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		err = errors.NewNotFound(batchv1.Resource("jobs"), name)
+	}
+	if !errors.IsNotFound(err) {
+		return job, err
+	}
+
+	podLabels := map[string]string{
+		"app.kubernetes.io/name":    "kubesnooze",
+		"app.kubernetes.io/part-of": "kubesnooze",
+		"kubesnooze.io/name":        snooze.Name,
+		"kubesnooze.io/action":      "wake",
+	}
+	job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: snooze.Namespace,
+			Labels:    podLabels,
+		},
+	}
+	applyRunnerJob(&job.Spec, snooze, "wake", selector, podLabels)
+	if owned {
+		if err := controllerutil.SetControllerReference(snooze, job, r.Scheme); err != nil {
+			return nil, err
+		}
+	} else {
+		job.Annotations = map[string]string{annotationSnoozeUID: string(snooze.UID)}
+	}
+	if err := r.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("started wake Job", "job", name)
+	return job, nil
+}
+
+// jobFinished returns the Complete or Failed condition of a finished Job, or
+// nil while it runs.
+func jobFinished(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Status == corev1.ConditionTrue &&
+			(condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) {
+			return condition
+		}
+	}
+	return nil
+}
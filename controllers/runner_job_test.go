@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/ptr"
+)
+
+func TestApplyJobSettings(t *testing.T) {
+	snooze := &kubesnoozev1alpha1.KubeSnooze{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dev"},
+		Spec:       kubesnoozev1alpha1.KubeSnoozeSpec{BackoffLimit: ptr.To[int32](0)},
+	}
+	var cronJob batchv1.CronJob
+	applyCronJobSettings(&cronJob, &snooze.Spec)
+	applyRunnerJob(&cronJob.Spec.JobTemplate.Spec, snooze, "sleep", labels.Everything(), nil)
+
+	job := cronJob.Spec.JobTemplate.Spec
+	if *cronJob.Spec.StartingDeadlineSeconds != defaultStartingDeadlineSeconds ||
+		*cronJob.Spec.SuccessfulJobsHistoryLimit != defaultSuccessfulJobsHistoryLimit ||
+		*cronJob.Spec.FailedJobsHistoryLimit != defaultFailedJobsHistoryLimit {
+		t.Errorf("CronJob spec = %+v, want the defaults", cronJob.Spec)
+	}
+	if *job.BackoffLimit != 0 {
+		t.Errorf("backoffLimit = %d, want the explicit 0", *job.BackoffLimit)
+	}
+	if *job.ActiveDeadlineSeconds != defaultActiveDeadlineSeconds || *job.TTLSecondsAfterFinished != defaultTTLSecondsAfterFinished {
+		t.Errorf("Job spec = %+v, want the defaults", job)
+	}
+	if pod := job.Template.Spec; pod.ServiceAccountName != runnerServiceAccountName || pod.Containers[0].Image != defaultRunnerImage {
+		t.Errorf("pod spec = %+v, want the runner", pod)
+	}
+}
+
+func TestMissedSleep(t *testing.T) {
+	// Tuesday 20:00 was the last sleep, Wednesday 07:00 the next wake.
+	scheduled := time.Date(2026, time.March, 3, 20, 0, 0, 0, time.UTC)
+	created := metav1.NewTime(scheduled.Add(-24 * time.Hour))
+	at := func(t time.Time) *metav1.Time { return &metav1.Time{Time: t} }
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		modify func(*kubesnoozev1alpha1.KubeSnooze, *batchv1.CronJob)
+		want   time.Time
+	}{
+		{name: "missed", now: scheduled.Add(time.Hour), want: scheduled},
+		{name: "within the deadline", now: scheduled.Add(2 * time.Minute)},
+		{name: "wake is due", now: scheduled.Add(12 * time.Hour)},
+		{
+			name: "ran on schedule", now: scheduled.Add(time.Hour),
+			modify: func(_ *kubesnoozev1alpha1.KubeSnooze, c *batchv1.CronJob) { c.Status.LastScheduleTime = at(scheduled) },
+		},
+		{
+			name: "woken since", now: scheduled.Add(time.Hour),
+			modify: func(s *kubesnoozev1alpha1.KubeSnooze, _ *batchv1.CronJob) {
+				s.Status.LastWakeTime = at(scheduled.Add(30 * time.Minute))
+			},
+		},
+		{
+			name: "already caught up", now: scheduled.Add(time.Hour),
+			modify: func(s *kubesnoozev1alpha1.KubeSnooze, _ *batchv1.CronJob) {
+				s.Status.LastSleepCatchUpTime = at(scheduled)
+			},
+		},
+		{
+			name: "resumed since", now: scheduled.Add(time.Hour),
+			modify: func(s *kubesnoozev1alpha1.KubeSnooze, _ *batchv1.CronJob) {
+				s.Status.Conditions = []metav1.Condition{{
+					Type: "Suspended", Status: metav1.ConditionFalse, Reason: "Resumed",
+					LastTransitionTime: metav1.NewTime(scheduled.Add(10 * time.Minute)),
+				}}
+			},
+		},
+		{
+			name: "CronJob created later", now: scheduled.Add(time.Hour),
+			modify: func(_ *kubesnoozev1alpha1.KubeSnooze, c *batchv1.CronJob) {
+				c.CreationTimestamp = metav1.NewTime(scheduled.Add(time.Minute))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snooze := &kubesnoozev1alpha1.KubeSnooze{Spec: kubesnoozev1alpha1.KubeSnoozeSpec{
+				SleepCron: "0 20 * * 1-5",
+				WakeCron:  "0 7 * * 1-5",
+			}}
+			cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: created}}
+			applyCronJobSettings(cronJob, &snooze.Spec)
+			if tt.modify != nil {
+				tt.modify(snooze, cronJob)
+			}
+			got, err := missedSleep(snooze, cronJob, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("missedSleep = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatchUpSleep(t *testing.T) {
+	r := newTestReconciler(t)
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubesnooze-app-sleep", Namespace: "dev", UID: "cronjob-uid"},
+	}
+	applyRunnerPodTemplate(&cronJob.Spec.JobTemplate.Spec.Template, corev1.Container{Name: "kubesnooze-runner"}, nil, nil)
+	scheduled := time.Date(2026, time.March, 3, 20, 0, 0, 0, time.UTC)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := r.catchUpSleep(ctx, cronJob, scheduled); err != nil {
+			t.Fatalf("catch-up %d: %v", i, err)
+		}
+	}
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.Items) != 1 {
+		t.Fatalf("jobs = %d, want 1", len(jobs.Items))
+	}
+	job := jobs.Items[0]
+	if job.Name != "kubesnooze-app-sleep-29542800" || job.Annotations[annotationCatchUp] != "2026-03-03T20:00:00Z" {
+		t.Errorf("job = %s %v", job.Name, job.Annotations)
+	}
+	if owner := metav1.GetControllerOf(&job); owner == nil || owner.UID != cronJob.UID {
+		t.Errorf("job owner = %+v, want the CronJob", owner)
+	}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+// runnerUID is the user runner pods run as by default. The runner is a static
+// binary, so it needs no passwd entry or home directory.
+const runnerUID = 65532
+
+// defaultRunnerResources fit the runner's few API calls, and satisfy
+// namespaces whose ResourceQuota requires requests and limits.
+func defaultRunnerResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+}
+
+// defaultRunnerSecurityContext meets the restricted Pod Security Standard.
+func defaultRunnerSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		ReadOnlyRootFilesystem:   ptr.To(true),
+		RunAsNonRoot:             ptr.To(true),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+	}
+}
+
+func defaultRunnerPodSecurityContext() *corev1.PodSecurityContext {
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: ptr.To(true),
+		RunAsUser:    ptr.To[int64](runnerUID),
+		RunAsGroup:   ptr.To[int64](runnerUID),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// applyRunnerPodTemplate fills in the runner pod from the defaults and the
+// KubeSnooze's overrides. podLabels identify the pod whatever the template
+// adds. container is the runner container, already named and configured.
+func applyRunnerPodTemplate(pod *corev1.PodTemplateSpec, container corev1.Container, podLabels map[string]string, template *kubesnoozev1alpha1.RunnerPodTemplate) {
+	if template == nil {
+		template = &kubesnoozev1alpha1.RunnerPodTemplate{}
+	}
+
+	labels := map[string]string{}
+	for key, value := range template.Labels {
+		labels[key] = value
+	}
+	pod.Labels = mergeLabels(labels, podLabels)
+	pod.Annotations = nil
+	if len(template.Annotations) > 0 {
+		pod.Annotations = map[string]string{}
+		for key, value := range template.Annotations {
+			pod.Annotations[key] = value
+		}
+	}
+
+	container.Resources = defaultRunnerResources()
+	if template.Resources != nil {
+		container.Resources = *template.Resources.DeepCopy()
+	}
+	container.SecurityContext = defaultRunnerSecurityContext()
+	if template.SecurityContext != nil {
+		container.SecurityContext = template.SecurityContext.DeepCopy()
+	}
+	container.ImagePullPolicy = template.ImagePullPolicy
+
+	spec := &pod.Spec
+	spec.Containers = []corev1.Container{container}
+	spec.SecurityContext = defaultRunnerPodSecurityContext()
+	if template.PodSecurityContext != nil {
+		spec.SecurityContext = template.PodSecurityContext.DeepCopy()
+	}
+	spec.NodeSelector = template.NodeSelector
+	spec.Tolerations = template.Tolerations
+	spec.Affinity = template.Affinity.DeepCopy()
+	spec.ImagePullSecrets = template.ImagePullSecrets
+	spec.PriorityClassName = template.PriorityClassName
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"testing"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+func TestApplyRunnerPodTemplateDefaults(t *testing.T) {
+	var pod corev1.PodTemplateSpec
+	applyRunnerPodTemplate(&pod, corev1.Container{Name: "kubesnooze-runner"}, map[string]string{"kubesnooze.io/name": "a"}, nil)
+
+	if len(pod.Spec.Containers) != 1 {
+		t.Fatalf("containers = %+v, want the runner", pod.Spec.Containers)
+	}
+	container := pod.Spec.Containers[0]
+	security := container.SecurityContext
+	if security == nil || !*security.RunAsNonRoot || !*security.ReadOnlyRootFilesystem || *security.AllowPrivilegeEscalation ||
+		len(security.Capabilities.Drop) != 1 || security.Capabilities.Drop[0] != "ALL" {
+		t.Errorf("container security context = %+v, want the restricted defaults", security)
+	}
+	if podSecurity := pod.Spec.SecurityContext; podSecurity == nil || podSecurity.SeccompProfile == nil ||
+		podSecurity.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault || *podSecurity.RunAsUser != runnerUID {
+		t.Errorf("pod security context = %+v, want RuntimeDefault seccomp as the runner user", podSecurity)
+	}
+	if container.Resources.Requests.Cpu().IsZero() || container.Resources.Limits.Memory().IsZero() {
+		t.Errorf("resources = %+v, want requests and limits", container.Resources)
+	}
+	if pod.Labels["kubesnooze.io/name"] != "a" {
+		t.Errorf("labels = %v", pod.Labels)
+	}
+}
+
+func TestApplyRunnerPodTemplateOverrides(t *testing.T) {
+	template := &kubesnoozev1alpha1.RunnerPodTemplate{
+		Labels:      map[string]string{"team": "a", "kubesnooze.io/name": "spoofed"},
+		Annotations: map[string]string{"sidecar.istio.io/inject": "false"},
+		Resources: &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+		NodeSelector:      map[string]string{"pool": "system"},
+		Tolerations:       []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+		ImagePullSecrets:  []corev1.LocalObjectReference{{Name: "registry"}},
+		ImagePullPolicy:   corev1.PullAlways,
+		PriorityClassName: "low",
+		PodSecurityContext: &corev1.PodSecurityContext{
+			RunAsUser: ptr.To[int64](1000),
+		},
+	}
+	var pod corev1.PodTemplateSpec
+	applyRunnerPodTemplate(&pod, corev1.Container{Name: "kubesnooze-runner"}, map[string]string{"kubesnooze.io/name": "a"}, template)
+
+	container := pod.Spec.Containers[0]
+	if pod.Labels["team"] != "a" || pod.Labels["kubesnooze.io/name"] != "a" {
+		t.Errorf("labels = %v, want the template's without overriding ours", pod.Labels)
+	}
+	if pod.Annotations["sidecar.istio.io/inject"] != "false" {
+		t.Errorf("annotations = %v", pod.Annotations)
+	}
+	if !container.Resources.Requests.Cpu().IsZero() || container.Resources.Limits.Memory().String() != "128Mi" {
+		t.Errorf("resources = %+v, want the template's in place of the defaults", container.Resources)
+	}
+	if container.SecurityContext == nil || !*container.SecurityContext.ReadOnlyRootFilesystem {
+		t.Errorf("container security context = %+v, want the default kept", container.SecurityContext)
+	}
+	if *pod.Spec.SecurityContext.RunAsUser != 1000 || pod.Spec.SecurityContext.SeccompProfile != nil {
+		t.Errorf("pod security context = %+v, want the template's", pod.Spec.SecurityContext)
+	}
+	if pod.Spec.NodeSelector["pool"] != "system" || len(pod.Spec.Tolerations) != 1 || pod.Spec.ImagePullSecrets[0].Name != "registry" ||
+		container.ImagePullPolicy != corev1.PullAlways || pod.Spec.PriorityClassName != "low" {
+		t.Errorf("pod spec = %+v", pod.Spec)
+	}
+
+	// Removing the template restores the defaults.
+	applyRunnerPodTemplate(&pod, corev1.Container{Name: "kubesnooze-runner"}, map[string]string{"kubesnooze.io/name": "a"}, nil)
+	if pod.Labels["team"] != "" || pod.Annotations != nil || pod.Spec.NodeSelector != nil || *pod.Spec.SecurityContext.RunAsUser != runnerUID {
+		t.Errorf("pod after removing the template = %+v", pod)
+	}
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileSuspend reflects spec.suspend in the Suspended condition. With
+// wakeOnSuspend, it wakes the workloads once per suspension; the condition's
+// reason records that the wake is done, after its Job is long gone.
+func (r *KubeSnoozeReconciler) reconcileSuspend(ctx context.Context, snooze *kubesnoozev1alpha1.KubeSnooze, selector labels.Selector) error {
+	jobName := fmt.Sprintf("kubesnooze-%s-wake-on-suspend", snooze.Name)
+	current := meta.FindStatusCondition(snooze.Status.Conditions, "Suspended")
+
+	if !snooze.Spec.Suspend {
+		if current == nil || current.Status != metav1.ConditionTrue {
+			return nil
+		}
+		// Let the next suspension wake again.
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: snooze.Namespace}}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		// Its transition time also stops sleeps missed while suspended from
+		// being caught up.
+		meta.SetStatusCondition(&snooze.Status.Conditions, metav1.Condition{
+			Type:    "Suspended",
+			Status:  metav1.ConditionFalse,
+			Reason:  "Resumed",
+			Message: "schedules are active",
+		})
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:    "Suspended",
+		Status:  metav1.ConditionTrue,
+		Reason:  "Suspended",
+		Message: "schedules are paused",
+	}
+	if snooze.Spec.WakeOnSuspend {
+		if current != nil && current.Status == metav1.ConditionTrue && (current.Reason == "Woken" || current.Reason == "WakeFailed") {
+			return nil
+		}
+		job, err := r.runWakeJob(ctx, snooze, selector, jobName, true)
+		if err != nil {
+			return err
+		}
+		switch finished := jobFinished(job); {
+		case finished == nil:
+			condition.Reason, condition.Message = "Waking", "schedules are paused; waking the workloads"
+		case finished.Type == batchv1.JobComplete:
+			condition.Reason, condition.Message = "Woken", "schedules are paused; the workloads were woken"
+		default:
+			condition.Reason = "WakeFailed"
+			condition.Message = fmt.Sprintf("schedules are paused; wake Job %s failed: %s", job.Name, finished.Message)
+		}
+	}
+	meta.SetStatusCondition(&snooze.Status.Conditions, condition)
+	return nil
+}
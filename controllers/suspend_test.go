@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileSuspend(t *testing.T) {
+	ctx := context.Background()
+	snooze := testSnooze()
+	snooze.Spec.Suspend = true
+	snooze.Spec.WakeOnSuspend = true
+	r := newTestReconciler(t, snooze)
+	key := client.ObjectKey{Namespace: "dev", Name: "app"}
+	jobKey := client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-wake-on-suspend"}
+	suspendedReason := func() string {
+		t.Helper()
+		if err := r.Get(ctx, key, snooze); err != nil {
+			t.Fatal(err)
+		}
+		condition := meta.FindStatusCondition(snooze.Status.Conditions, "Suspended")
+		if condition == nil {
+			return ""
+		}
+		return string(condition.Status) + "/" + condition.Reason
+	}
+	reconcileSnooze(t, r, key)
+
+	for _, action := range []string{"sleep", "wake"} {
+		var cronJob batchv1.CronJob
+		if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-" + action}, &cronJob); err != nil {
+			t.Fatal(err)
+		}
+		if !*cronJob.Spec.Suspend {
+			t.Errorf("%s CronJob is not suspended", action)
+		}
+	}
+	if got := suspendedReason(); got != "True/Waking" {
+		t.Errorf("Suspended = %s, want True/Waking", got)
+	}
+
+	var job batchv1.Job
+	if err := r.Get(ctx, jobKey, &job); err != nil {
+		t.Fatalf("wake Job: %v", err)
+	}
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	if err := r.Status().Update(ctx, &job); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, key)
+	if got := suspendedReason(); got != "True/Woken" {
+		t.Errorf("Suspended = %s, want True/Woken", got)
+	}
+
+	// The wake runs once per suspension, even after its Job is cleaned up.
+	if err := r.Delete(ctx, &job); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, key)
+	if err := r.Get(ctx, jobKey, &job); !errors.IsNotFound(err) {
+		t.Errorf("wake Job recreated: %v", err)
+	}
+
+	if err := r.Get(ctx, key, snooze); err != nil {
+		t.Fatal(err)
+	}
+	snooze.Spec.Suspend = false
+	if err := r.Update(ctx, snooze); err != nil {
+		t.Fatal(err)
+	}
+	reconcileSnooze(t, r, key)
+	if got := suspendedReason(); got != "False/Resumed" {
+		t.Errorf("Suspended = %s, want False/Resumed", got)
+	}
+	var sleep batchv1.CronJob
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "dev", Name: "kubesnooze-app-sleep"}, &sleep); err != nil {
+		t.Fatal(err)
+	}
+	if *sleep.Spec.Suspend {
+		t.Error("sleep CronJob still suspended after resuming")
+	}
+}
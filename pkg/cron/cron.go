@@ -0,0 +1,98 @@
+// Package cron computes fire times for the five-field cron expressions
+// accepted by Kubernetes CronJobs. Expressions are parsed by the same
+// library the CronJob controller uses, so they mean the same thing here.
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	robfig "github.com/robfig/cron/v3"
+)
+
+// starBit is set by the parser on fields written as "*" or "?", which
+// switches day-of-month and day-of-week from OR to AND.
+const starBit = 1 << 63
+
+// searchYears bounds Prev for expressions that never fire, such as
+// "0 0 30 2 *", as the parser's Next does.
+const searchYears = 5
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	spec *robfig.SpecSchedule
+}
+
+// Parse parses a standard five-field cron expression or an @descriptor, as a
+// CronJob's schedule is. @every is refused: it fires relative to when the
+// CronJob controller last ran it, so its times cannot be computed here. So are
+// TZ= and CRON_TZ= prefixes, which CronJobs reject in favor of timeZone.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "TZ=") || strings.HasPrefix(expr, "CRON_TZ=") {
+		return nil, fmt.Errorf("cron expression %q: set the time zone on the KubeSnooze instead", expr)
+	}
+	parsed, err := robfig.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+	}
+	spec, ok := parsed.(*robfig.SpecSchedule)
+	if !ok {
+		return nil, fmt.Errorf("cron expression %q: @every is not supported", expr)
+	}
+	return &Schedule{spec: spec}, nil
+}
+
+// Next returns the first fire time strictly after t, in t's location. It
+// returns the zero time if the schedule never fires.
+func (s *Schedule) Next(t time.Time) time.Time {
+	return s.spec.Next(t)
+}
+
+// Prev returns the last fire time strictly before t, in t's location. It
+// returns the zero time if the schedule has not fired in the searched years.
+func (s *Schedule) Prev(t time.Time) time.Time {
+	loc := t.Location()
+	start := t
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	if !t.Before(start) {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()-1, 0, 0, loc)
+	}
+	limit := t.Year() - searchYears
+
+	// Each step moves to the last minute of the previous month, day or hour.
+	for t.Year() >= limit {
+		var prev time.Time
+		switch {
+		case s.spec.Month&(1<<uint(t.Month())) == 0:
+			prev = time.Date(t.Year(), t.Month(), 1, 0, -1, 0, 0, loc)
+		case !s.dayMatches(t):
+			prev = time.Date(t.Year(), t.Month(), t.Day(), 0, -1, 0, 0, loc)
+		case s.spec.Hour&(1<<uint(t.Hour())) == 0:
+			prev = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), -1, 0, 0, loc)
+		case s.spec.Minute&(1<<uint(t.Minute())) == 0:
+			prev = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()-1, 0, 0, loc)
+		default:
+			return t
+		}
+		if !prev.Before(t) {
+			// The wall clock skipped the target minute at a daylight saving
+			// change and time.Date normalized it forward.
+			prev = t.Add(-time.Minute)
+		}
+		t = prev
+	}
+	return time.Time{}
+}
+
+// dayMatches ORs day-of-month and day-of-week unless either is a star, as
+// the parser's Next does.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.spec.Dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.spec.Dow&(1<<uint(t.Weekday())) != 0
+	if s.spec.Dom&starBit != 0 || s.spec.Dow&starBit != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,104 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday.
+	from := time.Date(2026, time.March, 4, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{name: "weekday evening", expr: "0 20 * * 1-5", want: time.Date(2026, time.March, 4, 20, 0, 0, 0, time.UTC)},
+		{name: "strictly after", expr: "30 10 * * *", want: time.Date(2026, time.March, 5, 10, 30, 0, 0, time.UTC)},
+		{name: "weekend by name", expr: "0 9 * * SAT,SUN", want: time.Date(2026, time.March, 7, 9, 0, 0, 0, time.UTC)},
+		{name: "sunday as 0", expr: "0 9 * * 0", want: time.Date(2026, time.March, 8, 9, 0, 0, 0, time.UTC)},
+		{name: "step", expr: "*/15 * * * *", want: time.Date(2026, time.March, 4, 10, 45, 0, 0, time.UTC)},
+		{name: "descriptor", expr: "@monthly", want: time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "dom or dow", expr: "0 0 10 * MON", want: time.Date(2026, time.March, 9, 0, 0, 0, 0, time.UTC)},
+		// As in the CronJob controller, "*/1" is still a star, so the days are
+		// AND-ed, while "*/2" is not.
+		{name: "star step of one", expr: "0 0 10 * */1", want: time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "star step of two", expr: "0 0 10 * */2", want: time.Date(2026, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{name: "star in a list", expr: "0 0 10 * MON,*", want: time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "never", expr: "0 0 30 2 *", want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	// Each is also refused as a CronJob schedule.
+	for _, expr := range []string{
+		"", "* * * *", "60 * * * *", "* * * * MOON", "5-1 * * * *", "*/0 * * * *",
+		"0 9 * * 7", "@DAILY", "@every 1h", "TZ=UTC 0 9 * * *", "CRON_TZ=UTC 0 9 * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestSchedulePrev(t *testing.T) {
+	// Wednesday.
+	from := time.Date(2026, time.March, 4, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{name: "weekday evening", expr: "0 20 * * 1-5", want: time.Date(2026, time.March, 3, 20, 0, 0, 0, time.UTC)},
+		{name: "strictly before", expr: "30 10 * * *", want: time.Date(2026, time.March, 3, 10, 30, 0, 0, time.UTC)},
+		{name: "weekend by name", expr: "0 9 * * SAT,SUN", want: time.Date(2026, time.March, 1, 9, 0, 0, 0, time.UTC)},
+		{name: "step", expr: "*/15 * * * *", want: time.Date(2026, time.March, 4, 10, 15, 0, 0, time.UTC)},
+		{name: "descriptor", expr: "@yearly", want: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "previous month", expr: "0 0 31 * *", want: time.Date(2026, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "star step of one", expr: "0 0 10 * */1", want: time.Date(2026, time.February, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "star step of two", expr: "0 0 10 * */2", want: time.Date(2026, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{name: "never", expr: "0 0 30 2 *", want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := schedule.Prev(from); !got.Equal(tt.want) {
+				t.Errorf("Prev = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulePrevDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	schedule, err := Parse("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 02:30 does not exist on 29 March 2026 in Berlin.
+	from := time.Date(2026, time.March, 29, 4, 0, 0, 0, berlin)
+	if got, want := schedule.Prev(from), time.Date(2026, time.March, 28, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("Prev = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package snooze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Sources of an Apply in the audit trail.
+const (
+	SourceSplash   = "splash"
+	SourceCLI      = "cli"
+	SourceSchedule = "schedule"
+)
+
+// Audit results. Only Succeeded and Failed runs changed anything; the others
+// are splash requests that did not run a wake.
+const (
+	AuditSucceeded   = "Succeeded"
+	AuditFailed      = "Failed"
+	AuditDenied      = "Denied"
+	AuditInProgress  = "InProgress"
+	AuditCoolingDown = "CoolingDown"
+)
+
+// maxRecordedChanges bounds the changes copied into a status WakeRecord; the
+// JSON log always has all of them.
+const maxRecordedChanges = 20
+
+// AuditRecord is one entry of the audit trail: who asked for what, and what
+// came of it.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Action     Action    `json:"action"`
+	Source     string    `json:"source"`
+	User       string    `json:"user,omitempty"`
+	Groups     []string  `json:"groups,omitempty"`
+	AuthMethod string    `json:"authMethod,omitempty"`
+	SourceIP   string    `json:"sourceIP,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	KubeSnooze string    `json:"kubeSnooze,omitempty"`
+	Selectors  []string  `json:"selectors,omitempty"`
+	Changes    []Change  `json:"changes,omitempty"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewAuditRecord describes an Apply of action on target that returned result
+// and err.
+func NewAuditRecord(action Action, source string, target Target, result *Result, err error) AuditRecord {
+	record := AuditRecord{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		Source:    source,
+		Namespace: target.Namespace,
+		Result:    AuditSucceeded,
+	}
+	for _, selector := range target.Selectors {
+		record.Selectors = append(record.Selectors, selector.String())
+	}
+	if result != nil {
+		record.Changes = result.Changes
+	}
+	if err != nil {
+		record.Result = AuditFailed
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// Write logs the record to w as one JSON line.
+func (r AuditRecord) Write(w io.Writer) error {
+	line, err := json.Marshal(struct {
+		Event string `json:"event"`
+		AuditRecord
+	}{Event: "kubesnooze.audit", AuditRecord: r})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", line)
+	return err
+}
+
+// WakeRecord converts the record to its KubeSnoozeStatus form.
+func (r AuditRecord) WakeRecord() kubesnoozev1alpha1.WakeRecord {
+	record := kubesnoozev1alpha1.WakeRecord{
+		Time:      metav1.NewTime(r.Time),
+		Source:    r.Source,
+		User:      r.User,
+		SourceIP:  r.SourceIP,
+		Selectors: r.Selectors,
+		Result:    r.Result,
+		Message:   r.Error,
+	}
+	for i, change := range r.Changes {
+		if i == maxRecordedChanges {
+			record.Changes = append(record.Changes, fmt.Sprintf("... and %d more", len(r.Changes)-i))
+			break
+		}
+		record.Changes = append(record.Changes, fmt.Sprintf("%s/%s %s: %s -> %s", change.Kind, change.Name, change.Field, change.From, change.To))
+	}
+	return record
+}
+
+// RecordWake adds a wake to the history in the status of the KubeSnooze at
+// key, retrying when another writer got there first. A successful wake also
+// sets LastWakeTime.
+func RecordWake(ctx context.Context, c client.Client, key client.ObjectKey, record AuditRecord) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var item kubesnoozev1alpha1.KubeSnooze
+		if err := c.Get(ctx, key, &item); err != nil {
+			return err
+		}
+		patch := client.MergeFromWithOptions(item.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		wake := record.WakeRecord()
+		item.Status.RecordWake(wake)
+		if record.Result == AuditSucceeded {
+			item.Status.LastWakeTime = &wake.Time
+		}
+		return c.Status().Patch(ctx, &item, patch)
+	})
+}
+
+// RecordSleep sets LastSleepTime in the status of the KubeSnooze at key after
+// a successful sleep, so its state reads Asleep until the next wake.
+func RecordSleep(ctx context.Context, c client.Client, key client.ObjectKey, record AuditRecord) error {
+	if record.Result != AuditSucceeded {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var item kubesnoozev1alpha1.KubeSnooze
+		if err := c.Get(ctx, key, &item); err != nil {
+			return err
+		}
+		patch := client.MergeFromWithOptions(item.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		at := metav1.NewTime(record.Time)
+		item.Status.LastSleepTime = &at
+		return c.Status().Patch(ctx, &item, patch)
+	})
+}
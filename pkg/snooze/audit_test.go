@@ -0,0 +1,128 @@
+package snooze
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAuditRecordWrite(t *testing.T) {
+	target := Target{Namespace: "dev", Selectors: []labels.Selector{labels.SelectorFromSet(labels.Set{"app": "web"})}}
+	result := &Result{Changes: []Change{{Kind: KindDeployment, Name: "web", Field: "replicas", From: "0", To: "2"}}}
+	record := NewAuditRecord(ActionWake, SourceSplash, target, result, errors.New("boom"))
+	record.User = "dev@example.com"
+
+	var out bytes.Buffer
+	if err := record.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	var logged map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &logged); err != nil {
+		t.Fatalf("not JSON: %q", out.String())
+	}
+	for key, want := range map[string]interface{}{
+		"event":  "kubesnooze.audit",
+		"action": "wake",
+		"source": "splash",
+		"user":   "dev@example.com",
+		"result": AuditFailed,
+		"error":  "boom",
+	} {
+		if logged[key] != want {
+			t.Errorf("%s = %v, want %v", key, logged[key], want)
+		}
+	}
+	if !strings.Contains(out.String(), `"selectors":["app=web"]`) || !strings.Contains(out.String(), `"field":"replicas"`) {
+		t.Errorf("selectors or changes missing: %s", out.String())
+	}
+}
+
+func TestAuditRecordWakeRecordBoundsChanges(t *testing.T) {
+	record := NewAuditRecord(ActionWake, SourceCLI, Target{Namespace: "dev"}, &Result{}, nil)
+	for i := 0; i < maxRecordedChanges+5; i++ {
+		record.Changes = append(record.Changes, Change{Kind: KindDeployment, Name: fmt.Sprintf("app-%d", i), Field: "replicas", From: "0", To: "1"})
+	}
+	wake := record.WakeRecord()
+	if len(wake.Changes) != maxRecordedChanges+1 {
+		t.Fatalf("changes = %d, want %d", len(wake.Changes), maxRecordedChanges+1)
+	}
+	if wake.Changes[0] != "Deployment/app-0 replicas: 0 -> 1" || wake.Changes[maxRecordedChanges] != "... and 5 more" {
+		t.Errorf("changes = %q ... %q", wake.Changes[0], wake.Changes[maxRecordedChanges])
+	}
+}
+
+func TestRecordWake(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kubesnoozev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	item := &kubesnoozev1alpha1.KubeSnooze{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dev"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(item).WithStatusSubresource(item).Build()
+	key := client.ObjectKeyFromObject(item)
+
+	ctx := context.Background()
+	if err := RecordWake(ctx, c, key, NewAuditRecord(ActionWake, SourceSchedule, Target{Namespace: "dev"}, nil, errors.New("boom"))); err != nil {
+		t.Fatal(err)
+	}
+	succeeded := NewAuditRecord(ActionWake, SourceCLI, Target{Namespace: "dev"}, nil, nil)
+	succeeded.User = "admin"
+	if err := RecordWake(ctx, c, key, succeeded); err != nil {
+		t.Fatal(err)
+	}
+
+	var got kubesnoozev1alpha1.KubeSnooze
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	history := got.Status.WakeHistory
+	if len(history) != 2 || history[0].User != "admin" || history[1].Result != AuditFailed || history[1].Message != "boom" {
+		t.Errorf("history = %+v", history)
+	}
+	if got.Status.LastWakeTime == nil {
+		t.Error("LastWakeTime not set by the successful wake")
+	}
+}
+
+func TestRecordSleep(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kubesnoozev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	item := &kubesnoozev1alpha1.KubeSnooze{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dev"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(item).WithStatusSubresource(item).Build()
+	key := client.ObjectKeyFromObject(item)
+
+	ctx := context.Background()
+	if err := RecordSleep(ctx, c, key, NewAuditRecord(ActionSleep, SourceSchedule, Target{Namespace: "dev"}, nil, errors.New("boom"))); err != nil {
+		t.Fatal(err)
+	}
+	var got kubesnoozev1alpha1.KubeSnooze
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.LastSleepTime != nil {
+		t.Errorf("LastSleepTime = %v after a failed sleep, want unset", got.Status.LastSleepTime)
+	}
+
+	if err := RecordSleep(ctx, c, key, NewAuditRecord(ActionSleep, SourceSchedule, Target{Namespace: "dev"}, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.LastSleepTime == nil || len(got.Status.WakeHistory) != 0 {
+		t.Errorf("status = %+v, want LastSleepTime and no wake history", got.Status)
+	}
+}
@@ -0,0 +1,286 @@
+package snooze
+
+import (
+	"context"
+	"testing"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "dev"
+
+var testLabels = map[string]string{"kubesnooze.io/enabled": "true"}
+
+func newTestEngine(objects ...runtime.Object) (*Engine, Target) {
+	engine := &Engine{
+		Client: fake.NewSimpleClientset(objects...),
+		Sleep:  Behavior{SuspendCronJobs: true},
+	}
+	target := Target{
+		Namespace: testNamespace,
+		Selectors: []labels.Selector{labels.SelectorFromSet(testLabels)},
+	}
+	return engine, target
+}
+
+func testDeployment(name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: testLabels},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+}
+
+func testHPA(name, target string, minReplicas int32) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: testLabels},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: KindDeployment, Name: target},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    10,
+		},
+	}
+}
+
+func getDeployment(t *testing.T, engine *Engine, name string) *appsv1.Deployment {
+	t.Helper()
+	deployment, err := engine.Client.AppsV1().Deployments(testNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment %s: %v", name, err)
+	}
+	return deployment
+}
+
+func apply(t *testing.T, engine *Engine, action Action, target Target) *Result {
+	t.Helper()
+	result, err := engine.Apply(context.Background(), action, target)
+	if err != nil {
+		t.Fatalf("%s: %v", action, err)
+	}
+	return result
+}
+
+func TestApplySleepWake(t *testing.T) {
+	outside := testDeployment("other", 2)
+	outside.Labels = nil
+	suspended := false
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: testNamespace, Labels: testLabels},
+		Spec:       batchv1.CronJobSpec{Suspend: &suspended},
+	}
+	engine, target := newTestEngine(testDeployment("api", 3), outside, cronJob)
+
+	result := apply(t, engine, ActionSleep, target)
+	if len(result.Changes) != 2 {
+		t.Errorf("sleep changes = %+v, want 2", result.Changes)
+	}
+	api := getDeployment(t, engine, "api")
+	if *api.Spec.Replicas != 0 || api.Annotations[AnnotationOriginalReplicas] != "3" {
+		t.Errorf("after sleep: replicas %d, annotations %v", *api.Spec.Replicas, api.Annotations)
+	}
+	if other := getDeployment(t, engine, "other"); *other.Spec.Replicas != 2 {
+		t.Errorf("unselected deployment scaled to %d", *other.Spec.Replicas)
+	}
+
+	apply(t, engine, ActionWake, target)
+	api = getDeployment(t, engine, "api")
+	if *api.Spec.Replicas != 3 {
+		t.Errorf("after wake: replicas %d, want 3", *api.Spec.Replicas)
+	}
+	if _, ok := api.Annotations[AnnotationOriginalReplicas]; ok {
+		t.Errorf("after wake: annotation not cleared")
+	}
+	job, err := engine.Client.BatchV1().CronJobs(testNamespace).Get(context.Background(), "report", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Suspend == nil || *job.Spec.Suspend {
+		t.Errorf("after wake: cronjob still suspended")
+	}
+}
+
+func TestApplyHPADelete(t *testing.T) {
+	engine, target := newTestEngine(testDeployment("api", 4), testHPA("api", "api", 2))
+	engine.Sleep.HPAStrategy = HPAStrategyDelete
+	ctx := context.Background()
+
+	apply(t, engine, ActionSleep, target)
+	_, err := engine.Client.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(ctx, "api", metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("hpa after sleep: err = %v, want NotFound", err)
+	}
+	if api := getDeployment(t, engine, "api"); *api.Spec.Replicas != 0 || api.Annotations[AnnotationHPASnapshot] == "" {
+		t.Fatalf("after sleep: replicas %d, annotations %v", *api.Spec.Replicas, api.Annotations)
+	}
+
+	apply(t, engine, ActionWake, target)
+	hpa, err := engine.Client.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(ctx, "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("hpa after wake: %v", err)
+	}
+	if *hpa.Spec.MinReplicas != 2 {
+		t.Errorf("recreated hpa minReplicas %d, want 2", *hpa.Spec.MinReplicas)
+	}
+	api := getDeployment(t, engine, "api")
+	if *api.Spec.Replicas != 4 {
+		t.Errorf("after wake: replicas %d, want 4", *api.Spec.Replicas)
+	}
+	if _, ok := api.Annotations[AnnotationHPASnapshot]; ok {
+		t.Errorf("after wake: snapshot annotation not cleared")
+	}
+}
+
+func TestApplySnapshotSurvivesReapply(t *testing.T) {
+	snapshot := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: SnapshotConfigMapName("dev"), Namespace: testNamespace}}
+	engine, target := newTestEngine(testDeployment("api", 3), snapshot)
+	target.SnapshotName = snapshot.Name
+	ctx := context.Background()
+
+	apply(t, engine, ActionSleep, target)
+
+	// A GitOps re-apply drops the annotation but keeps the object scaled down.
+	api := getDeployment(t, engine, "api")
+	api.Annotations = nil
+	if _, err := engine.Client.AppsV1().Deployments(testNamespace).Update(ctx, api, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	apply(t, engine, ActionWake, target)
+	if api := getDeployment(t, engine, "api"); *api.Spec.Replicas != 3 {
+		t.Errorf("after wake: replicas %d, want 3 from snapshot", *api.Spec.Replicas)
+	}
+	configMap, err := engine.Client.CoreV1().ConfigMaps(testNamespace).Get(ctx, snapshot.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configMap.Data) != 0 {
+		t.Errorf("snapshot not cleared after wake: %v", configMap.Data)
+	}
+}
+
+func TestApplyHPADeleteSnapshotSurvivesReapply(t *testing.T) {
+	snapshot := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: SnapshotConfigMapName("dev"), Namespace: testNamespace}}
+	// The HPA is selected; its scale target is not.
+	backend := testDeployment("backend", 4)
+	backend.Labels = nil
+	engine, target := newTestEngine(backend, testHPA("api", "backend", 2), snapshot)
+	engine.Sleep.HPAStrategy = HPAStrategyDelete
+	target.SnapshotName = snapshot.Name
+	ctx := context.Background()
+
+	apply(t, engine, ActionSleep, target)
+	configMap, err := engine.Client.CoreV1().ConfigMaps(testNamespace).Get(ctx, snapshot.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := configMap.Data["horizontalpodautoscaler.api"]; !ok || !HoldsHPASnapshot(configMap) {
+		t.Fatalf("snapshot after sleep = %v, want the deleted HPA", configMap.Data)
+	}
+
+	// A GitOps re-apply drops the annotations on the scale target.
+	scaleTarget := getDeployment(t, engine, "backend")
+	scaleTarget.Annotations = nil
+	if _, err := engine.Client.AppsV1().Deployments(testNamespace).Update(ctx, scaleTarget, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := engine.Inspect(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (WorkloadStatus{Kind: KindHPA, Name: "api", Field: "minReplicas", Current: "deleted", Original: "2"}); len(statuses) != 1 || statuses[0] != want {
+		t.Errorf("inspect after re-apply = %+v, want %+v", statuses, want)
+	}
+
+	apply(t, engine, ActionWake, target)
+	hpa, err := engine.Client.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(ctx, "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("hpa after wake: %v", err)
+	}
+	if *hpa.Spec.MinReplicas != 2 {
+		t.Errorf("recreated hpa minReplicas %d, want 2", *hpa.Spec.MinReplicas)
+	}
+	if backend := getDeployment(t, engine, "backend"); *backend.Spec.Replicas != 4 {
+		t.Errorf("after wake: replicas %d, want 4 from snapshot", *backend.Spec.Replicas)
+	}
+	if configMap, err = engine.Client.CoreV1().ConfigMaps(testNamespace).Get(ctx, snapshot.Name, metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(configMap.Data) != 0 {
+		t.Errorf("snapshot not cleared after wake: %v", configMap.Data)
+	}
+}
+
+func TestApplyRestoresCronJobSuspend(t *testing.T) {
+	snapshot := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: SnapshotConfigMapName("dev"), Namespace: testNamespace}}
+	suspended, running := true, false
+	paused := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "paused", Namespace: testNamespace, Labels: testLabels},
+		Spec:       batchv1.CronJobSpec{Suspend: &suspended},
+	}
+	report := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: testNamespace, Labels: testLabels},
+		Spec:       batchv1.CronJobSpec{Suspend: &running},
+	}
+	engine, target := newTestEngine(paused, report, snapshot)
+	target.SnapshotName = snapshot.Name
+	ctx := context.Background()
+
+	apply(t, engine, ActionSleep, target)
+	apply(t, engine, ActionWake, target)
+	for name, want := range map[string]bool{"paused": true, "report": false} {
+		job, err := engine.Client.BatchV1().CronJobs(testNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Spec.Suspend == nil || *job.Spec.Suspend != want {
+			t.Errorf("%s after wake: suspend %v, want %t", name, job.Spec.Suspend, want)
+		}
+	}
+}
+
+func TestFromKubeSnoozeSkipsUnsuspendedCronJobs(t *testing.T) {
+	suspended, sleepSuspends := true, false
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: testNamespace, Labels: testLabels},
+		Spec:       batchv1.CronJobSpec{Suspend: &suspended},
+	}
+	snooze := &kubesnoozev1alpha1.KubeSnooze{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: testNamespace},
+		Spec: kubesnoozev1alpha1.KubeSnoozeSpec{
+			Selector: metav1.LabelSelector{MatchLabels: testLabels},
+			Sleep:    kubesnoozev1alpha1.SleepBehavior{SnoozeBehavior: kubesnoozev1alpha1.SnoozeBehavior{SuspendCronJobs: &sleepSuspends}},
+		},
+	}
+	engine, target, err := FromKubeSnooze(fake.NewSimpleClientset(cronJob), snooze)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.SnapshotName = ""
+
+	// Neither sleep nor wake suspends CronJobs, so wake keeps a manual suspend.
+	apply(t, engine, ActionWake, target)
+	job, err := engine.Client.BatchV1().CronJobs(testNamespace).Get(context.Background(), "report", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Suspend == nil || !*job.Spec.Suspend {
+		t.Errorf("after wake: cronjob unsuspended")
+	}
+}
+
+func TestApplyRejectsKubeSystem(t *testing.T) {
+	engine, target := newTestEngine()
+	target.Namespace = "kube-system"
+	if _, err := engine.Apply(context.Background(), ActionSleep, target); err == nil {
+		t.Error("Apply in kube-system succeeded, want error")
+	}
+}
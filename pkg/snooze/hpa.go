@@ -0,0 +1,176 @@
+package snooze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// sleepHPAByDelete snapshots the HPA into the snapshot ConfigMap and onto its
+// scale target, scales the target down and removes the HPA so it cannot hold
+// the workload above zero.
+func (r *run) sleepHPAByDelete(ctx context.Context, hpa HPA) error {
+	spec := hpaSnapshot(hpa.HorizontalPodAutoscaler)
+	snapshot, err := encodeHPASnapshot(spec)
+	if err != nil {
+		return err
+	}
+	r.snap.entry(KindHPA, hpa.Name).HPA = spec
+	scaleTarget, err := getScalable(ctx, r.Client, hpa.Namespace, hpa.Spec.ScaleTargetRef)
+	if err != nil {
+		return fmt.Errorf("hpa %s: %w", hpa.Name, err)
+	}
+	annotationsOf(scaleTarget)[AnnotationHPASnapshot] = snapshot
+	if err := r.sleepScalable(ctx, scaleTarget); err != nil {
+		return err
+	}
+
+	err = r.Client.AutoscalingV2().HorizontalPodAutoscalers(hpa.Namespace).Delete(ctx, hpa.Name, r.deleteOptions())
+	if err := ignoreNotFound(err); err != nil {
+		return err
+	}
+	if err == nil {
+		r.record(hpa, "", "present", "deleted")
+	}
+	return nil
+}
+
+// restoreHPASnapshots recreates HPAs removed by the Delete strategy. The
+// snapshot ConfigMap is read first; the annotations on the scale targets, which
+// may sit outside the selectors, cover runs without one. Every Deployment and
+// StatefulSet in the namespace is checked for them.
+func (r *run) restoreHPASnapshots(ctx context.Context) error {
+	scalables, err := listScalables(ctx, r.Client, r.target.Namespace, nil)
+	if err != nil {
+		return err
+	}
+	restored := map[string]bool{}
+	for _, scalable := range scalables {
+		hpa, err := decodeHPASnapshot(scalable.GetAnnotations())
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", scalable.Kind(), scalable.GetName(), err)
+		}
+		if hpa == nil {
+			continue
+		}
+		if recorded := r.snap.recorded(KindHPA, hpa.Name); recorded.HPA != nil {
+			hpa = recorded.HPA
+		}
+		if !matchesAny(r.target.Selectors, hpa.Labels) {
+			continue
+		}
+		// Scale the target first; an HPA created against zero replicas stays disabled.
+		delete(scalable.GetAnnotations(), AnnotationHPASnapshot)
+		if err := r.wakeScalable(ctx, scalable, true); err != nil {
+			return err
+		}
+		if err := r.restoreHPA(ctx, hpa); err != nil {
+			return err
+		}
+		restored[hpa.Name] = true
+	}
+
+	// Snapshots whose annotation was wiped, e.g. by a GitOps re-apply.
+	for _, hpa := range r.snap.hpas() {
+		if restored[hpa.Name] || !matchesAny(r.target.Selectors, hpa.Labels) {
+			continue
+		}
+		scalable, err := getScalable(ctx, r.Client, r.target.Namespace, hpa.Spec.ScaleTargetRef)
+		switch {
+		case apierrors.IsNotFound(err):
+			r.logf("hpa %s: scale target %s not found", hpa.Name, hpa.Spec.ScaleTargetRef.Name)
+		case err != nil:
+			return fmt.Errorf("hpa %s: %w", hpa.Name, err)
+		default:
+			if err := r.wakeScalable(ctx, scalable, false); err != nil {
+				return err
+			}
+		}
+		if err := r.restoreHPA(ctx, hpa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreHPA recreates a snapshotted HPA and drops it from the snapshot.
+func (r *run) restoreHPA(ctx context.Context, hpa *autoscalingv2.HorizontalPodAutoscaler) error {
+	hpa = hpa.DeepCopy()
+	hpa.Namespace = r.target.Namespace
+	if err := r.createHPA(ctx, HPA{hpa}); err != nil {
+		return err
+	}
+	r.snap.forget(KindHPA, hpa.Name)
+	return nil
+}
+
+func (r *run) createHPA(ctx context.Context, hpa HPA) error {
+	_, err := r.Client.AutoscalingV2().HorizontalPodAutoscalers(hpa.Namespace).Create(ctx, hpa.HorizontalPodAutoscaler, r.createOptions())
+	if apierrors.IsAlreadyExists(err) {
+		// Someone (usually GitOps) already put it back; keep theirs.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.record(hpa, "", "deleted", "present")
+	return nil
+}
+
+func matchesAny(selectors []labels.Selector, set map[string]string) bool {
+	for _, selector := range selectors {
+		if selector == nil || selector.Matches(labels.Set(set)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hpaSnapshot keeps the parts of an HPA needed to recreate it. A minReplicas
+// lowered by an earlier MinReplicas sleep is rolled back first so the snapshot
+// holds the original spec.
+func hpaSnapshot(hpa *autoscalingv2.HorizontalPodAutoscaler) *autoscalingv2.HorizontalPodAutoscaler {
+	annotations := map[string]string{}
+	for key, value := range hpa.Annotations {
+		if key != AnnotationOriginalHPAMin {
+			annotations[key] = value
+		}
+	}
+	snapshot := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        hpa.Name,
+			Labels:      hpa.Labels,
+			Annotations: annotations,
+		},
+		Spec: *hpa.Spec.DeepCopy(),
+	}
+	if original := ParseInt32Pointer(hpa.Annotations[AnnotationOriginalHPAMin]); original != nil {
+		snapshot.Spec.MinReplicas = original
+	}
+	return snapshot
+}
+
+func encodeHPASnapshot(snapshot *autoscalingv2.HorizontalPodAutoscaler) (string, error) {
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func decodeHPASnapshot(annotations map[string]string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	raw, ok := annotations[AnnotationHPASnapshot]
+	if !ok {
+		return nil, nil
+	}
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	if err := json.Unmarshal([]byte(raw), hpa); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", AnnotationHPASnapshot, err)
+	}
+	return hpa, nil
+}
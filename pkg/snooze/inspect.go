@@ -0,0 +1,103 @@
+package snooze
+
+import (
+	"context"
+	"strconv"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// WorkloadStatus compares an object's live value with what sleep recorded.
+type WorkloadStatus struct {
+	Kind     string
+	Name     string
+	Field    string
+	Current  string
+	Original string
+}
+
+// Inspect lists the objects Apply would touch for target, with their live
+// values and the originals recorded by the last sleep. Nothing is modified.
+func (e *Engine) Inspect(ctx context.Context, target Target) ([]WorkloadStatus, error) {
+	snap, err := e.loadSnapshot(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []WorkloadStatus
+	seen := map[string]bool{}
+	for _, selector := range target.Selectors {
+		workloads, err := e.Workloads(ctx, target.Namespace, selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, workload := range workloads {
+			key := snapshotKey(workload.Kind(), workload.GetName())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			statuses = append(statuses, workloadStatus(workload, snap.recorded(workload.Kind(), workload.GetName())))
+		}
+	}
+
+	// HPAs removed by the Delete strategy only survive as snapshots, on their
+	// targets and in the snapshot ConfigMap, which wake prefers.
+	scalables, err := listScalables(ctx, e.Client, target.Namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	deleted := map[string]bool{}
+	for _, scalable := range scalables {
+		hpa, err := decodeHPASnapshot(scalable.GetAnnotations())
+		if err != nil || hpa == nil {
+			continue
+		}
+		if recorded := snap.recorded(KindHPA, hpa.Name); recorded.HPA != nil {
+			hpa = recorded.HPA
+		}
+		if !deleted[hpa.Name] && matchesAny(target.Selectors, hpa.Labels) {
+			deleted[hpa.Name] = true
+			statuses = append(statuses, deletedHPAStatus(hpa))
+		}
+	}
+	for _, hpa := range snap.hpas() {
+		if !deleted[hpa.Name] && matchesAny(target.Selectors, hpa.Labels) {
+			deleted[hpa.Name] = true
+			statuses = append(statuses, deletedHPAStatus(hpa))
+		}
+	}
+	return statuses, nil
+}
+
+func workloadStatus(workload Workload, recorded snapshotEntry) WorkloadStatus {
+	annotations := workload.GetAnnotations()
+	status := WorkloadStatus{Kind: workload.Kind(), Name: workload.GetName()}
+	switch w := workload.(type) {
+	case Scalable:
+		status.Field = "replicas"
+		status.Current = formatInt(w.Replicas())
+		status.Original = FormatInt32(firstInt32(recorded.Replicas, ParseInt32Pointer(annotations[AnnotationOriginalReplicas])))
+	case HPA:
+		status.Field = "minReplicas"
+		status.Current = FormatInt32(w.Spec.MinReplicas)
+		status.Original = FormatInt32(firstInt32(recorded.MinReplicas, ParseInt32Pointer(annotations[AnnotationOriginalHPAMin])))
+	case CronJob:
+		status.Field = "suspend"
+		status.Current = strconv.FormatBool(w.Spec.Suspend != nil && *w.Spec.Suspend)
+		status.Original = "-"
+		if recorded.Suspend != nil {
+			status.Original = strconv.FormatBool(*recorded.Suspend)
+		}
+	}
+	return status
+}
+
+func deletedHPAStatus(hpa *autoscalingv2.HorizontalPodAutoscaler) WorkloadStatus {
+	return WorkloadStatus{
+		Kind:     KindHPA,
+		Name:     hpa.Name,
+		Field:    "minReplicas",
+		Current:  "deleted",
+		Original: FormatInt32(hpa.Spec.MinReplicas),
+	}
+}
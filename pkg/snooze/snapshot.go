@@ -0,0 +1,162 @@
+package snooze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// snapshotEntry is the pre-sleep state of a single object. Annotations on the
+// object carry the same data, but GitOps re-applies wipe those, so wake reads
+// this copy first.
+type snapshotEntry struct {
+	Kind            string `json:"kind"`
+	Name            string `json:"name"`
+	Replicas        *int32 `json:"replicas,omitempty"`
+	MinReplicas     *int32 `json:"minReplicas,omitempty"`
+	Suspend         *bool  `json:"suspend,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// HPA is an HPA the Delete strategy removed, as wake recreates it.
+	HPA *autoscalingv2.HorizontalPodAutoscaler `json:"hpa,omitempty"`
+}
+
+// snapshotStore holds the entries of the per-KubeSnooze snapshot ConfigMap. A
+// nil store is valid and records nothing, which keeps annotation-only runs
+// working when no ConfigMap is configured.
+type snapshotStore struct {
+	configMap *corev1.ConfigMap
+	entries   map[string]*snapshotEntry
+}
+
+func (e *Engine) loadSnapshot(ctx context.Context, target Target) (*snapshotStore, error) {
+	if target.SnapshotName == "" {
+		return nil, nil
+	}
+	configMap, err := e.Client.CoreV1().ConfigMaps(target.Namespace).Get(ctx, target.SnapshotName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// The controller creates it; until then fall back to annotations only.
+			e.logf("snapshot configmap %s not found, using annotations only", target.SnapshotName)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	store := &snapshotStore{
+		configMap: configMap,
+		entries:   map[string]*snapshotEntry{},
+	}
+	for key, raw := range configMap.Data {
+		entry := &snapshotEntry{}
+		if err := json.Unmarshal([]byte(raw), entry); err != nil {
+			return nil, fmt.Errorf("snapshot %s key %s: %w", target.SnapshotName, key, err)
+		}
+		store.entries[key] = entry
+	}
+	return store, nil
+}
+
+// entry returns the mutable entry for an object, creating it when missing.
+func (s *snapshotStore) entry(kind, name string) *snapshotEntry {
+	if s == nil {
+		return &snapshotEntry{Kind: kind, Name: name}
+	}
+	key := snapshotKey(kind, name)
+	if _, ok := s.entries[key]; !ok {
+		s.entries[key] = &snapshotEntry{Kind: kind, Name: name}
+	}
+	return s.entries[key]
+}
+
+// recorded returns a copy of the entry for an object, or a zero entry.
+func (s *snapshotStore) recorded(kind, name string) snapshotEntry {
+	if s == nil {
+		return snapshotEntry{}
+	}
+	if entry, ok := s.entries[snapshotKey(kind, name)]; ok {
+		return *entry
+	}
+	return snapshotEntry{}
+}
+
+// forget drops an object once wake has restored it.
+func (s *snapshotStore) forget(kind, name string) {
+	if s == nil {
+		return
+	}
+	delete(s.entries, snapshotKey(kind, name))
+}
+
+// hpas returns the HPAs the Delete strategy removed, by name.
+func (s *snapshotStore) hpas() []*autoscalingv2.HorizontalPodAutoscaler {
+	if s == nil {
+		return nil
+	}
+	var hpas []*autoscalingv2.HorizontalPodAutoscaler
+	for _, entry := range s.entries {
+		if entry.HPA != nil {
+			hpas = append(hpas, entry.HPA)
+		}
+	}
+	sort.Slice(hpas, func(i, j int) bool { return hpas[i].Name < hpas[j].Name })
+	return hpas
+}
+
+// HoldsHPASnapshot reports whether a snapshot ConfigMap keeps an HPA the
+// Delete strategy removed, which the next wake recreates.
+func HoldsHPASnapshot(configMap *corev1.ConfigMap) bool {
+	for _, raw := range configMap.Data {
+		entry := &snapshotEntry{}
+		if json.Unmarshal([]byte(raw), entry) == nil && entry.HPA != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *snapshotStore) save(ctx context.Context, clientset kubernetes.Interface) error {
+	if s == nil {
+		return nil
+	}
+	data := make(map[string]string, len(s.entries))
+	for key, entry := range s.entries {
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data[key] = string(raw)
+	}
+	s.configMap.Data = data
+	_, err := clientset.CoreV1().ConfigMaps(s.configMap.Namespace).Update(ctx, s.configMap, metav1.UpdateOptions{})
+	return err
+}
+
+func snapshotKey(kind, name string) string {
+	return strings.ToLower(kind) + "." + name
+}
+
+// keepRecorded mirrors recordOriginal for snapshot values: a recorded value
+// survives only while the object still sits at the sleep target.
+func keepRecorded(recorded *int32, live, sleepTarget int32) *int32 {
+	if recorded != nil && live == sleepTarget {
+		return recorded
+	}
+	return int32Ptr(live)
+}
+
+func firstInt32(values ...*int32) *int32 {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
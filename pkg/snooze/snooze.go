@@ -0,0 +1,469 @@
+// Package snooze is the sleep/wake engine shared by the runner, the splash
+// server and the kubectl-snooze plugin. An Engine applies an Action to the
+// Workloads a Target selects, recording what it needs to undo the change in
+// annotations and, optionally, a snapshot ConfigMap.
+package snooze
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Action is what Apply does to the selected workloads.
+type Action string
+
+const (
+	ActionSleep Action = "sleep"
+	ActionWake  Action = "wake"
+)
+
+const (
+	AnnotationOriginalReplicas = "kubesnooze.io/original-replicas"
+	AnnotationOriginalHPAMin   = "kubesnooze.io/original-hpa-min-replicas"
+	AnnotationHPASnapshot      = "kubesnooze.io/hpa-snapshot"
+
+	HPAStrategyMinReplicas = "MinReplicas"
+	HPAStrategyDelete      = "Delete"
+)
+
+// Behavior is a resolved SnoozeBehavior. Nil values fall back to the runner
+// defaults: sleep scales to 0 with HPA minReplicas 1, wake restores originals.
+type Behavior struct {
+	Replicas        *int32
+	HPAMinReplicas  *int32
+	SuspendCronJobs bool
+	// SkipCronJobs leaves CronJobs untouched, whatever SuspendCronJobs says.
+	SkipCronJobs bool
+	// HPAStrategy is only read for sleep; empty means MinReplicas.
+	HPAStrategy string
+}
+
+// Target selects the workloads an action applies to.
+type Target struct {
+	Namespace string
+	// Selectors are applied one after another; objects may match several.
+	Selectors []labels.Selector
+	// SnapshotName is the snapshot ConfigMap; empty means annotations only.
+	SnapshotName string
+}
+
+// Engine applies sleep and wake actions.
+type Engine struct {
+	Client kubernetes.Interface
+	Sleep  Behavior
+	Wake   Behavior
+	// DryRun sends every write with dryRun=All and leaves the snapshot untouched.
+	DryRun bool
+	// Logf receives progress messages; nil discards them.
+	Logf func(format string, args ...interface{})
+}
+
+// Change is one field a run changed, or would change in dry-run mode.
+type Change struct {
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Result lists what a run did.
+type Result struct {
+	Changes []Change
+}
+
+// Apply runs action against every workload the target selects. The returned
+// Result covers the changes made before any error.
+func (e *Engine) Apply(ctx context.Context, action Action, target Target) (*Result, error) {
+	if action != ActionSleep && action != ActionWake {
+		return nil, fmt.Errorf("invalid action: %q", action)
+	}
+	if target.Namespace == "kube-system" {
+		// Avoid mutating core system workloads.
+		return nil, fmt.Errorf("kube-system is ignored by design")
+	}
+
+	snap, err := e.loadSnapshot(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	r := &run{
+		Engine: e,
+		action: action,
+		target: target,
+		snap:   snap,
+		result: &Result{},
+	}
+
+	runErr := r.process(ctx)
+	// Save even after a partial run so wake knows about everything already asleep.
+	if !e.DryRun {
+		if err := snap.save(ctx, e.Client); err != nil {
+			return r.result, err
+		}
+	}
+	return r.result, runErr
+}
+
+// run is the state of a single Apply call.
+type run struct {
+	*Engine
+	action Action
+	target Target
+	snap   *snapshotStore
+	result *Result
+}
+
+func (r *run) process(ctx context.Context) error {
+	namespace := r.target.Namespace
+	for _, selector := range r.target.Selectors {
+		scalables, err := listScalables(ctx, r.Client, namespace, selector)
+		if err != nil {
+			return err
+		}
+		for _, scalable := range scalables {
+			if err := r.applyScalable(ctx, scalable); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.action == ActionWake {
+		// Bring back HPAs removed by the Delete strategy before adjusting the rest.
+		if err := r.restoreHPASnapshots(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, selector := range r.target.Selectors {
+		hpas, err := listHPAs(ctx, r.Client, namespace, selector)
+		if err != nil {
+			return err
+		}
+		for _, hpa := range hpas {
+			if err := r.applyHPA(ctx, hpa); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.behavior().SkipCronJobs {
+		return nil
+	}
+	for _, selector := range r.target.Selectors {
+		cronJobs, err := listCronJobs(ctx, r.Client, namespace, selector)
+		if err != nil {
+			return err
+		}
+		for _, cronJob := range cronJobs {
+			if err := r.applyCronJob(ctx, cronJob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// behavior is the Behavior of the run's action.
+func (r *run) behavior() Behavior {
+	if r.action == ActionSleep {
+		return r.Sleep
+	}
+	return r.Wake
+}
+
+func (r *run) applyScalable(ctx context.Context, w Scalable) error {
+	if r.action == ActionSleep {
+		return r.sleepScalable(ctx, w)
+	}
+	return r.wakeScalable(ctx, w, false)
+}
+
+func (r *run) sleepScalable(ctx context.Context, w Scalable) error {
+	live := w.Replicas()
+	target := defaultInt32(r.Sleep.Replicas, 0)
+
+	// Persist the original replicas so wake can restore them.
+	recordOriginal(annotationsOf(w), AnnotationOriginalReplicas, live, target)
+	entry := r.snap.entry(w.Kind(), w.GetName())
+	entry.Replicas = keepRecorded(entry.Replicas, live, target)
+	w.SetReplicas(target)
+	resourceVersion, err := w.update(ctx, r.Client, r.updateOptions())
+	if err != nil {
+		return err
+	}
+	entry.ResourceVersion = resourceVersion
+	r.record(w, "replicas", formatInt(live), formatInt(target))
+	return nil
+}
+
+// wakeScalable restores replicas; force writes the object even when there is
+// no target, for callers that changed its annotations.
+func (r *run) wakeScalable(ctx context.Context, w Scalable, force bool) error {
+	r.warnIfChanged(w)
+	live := w.Replicas()
+
+	// Prefer the snapshot, then the annotation, unless wake pins a value.
+	recorded := r.snap.recorded(w.Kind(), w.GetName())
+	target := restoreOriginal(annotationsOf(w), AnnotationOriginalReplicas, firstInt32(r.Wake.Replicas, recorded.Replicas))
+	if target == nil && !force {
+		return nil
+	}
+	if target != nil {
+		w.SetReplicas(*target)
+	}
+	if _, err := w.update(ctx, r.Client, r.updateOptions()); err != nil {
+		return err
+	}
+	r.snap.forget(w.Kind(), w.GetName())
+	r.record(w, "replicas", formatInt(live), formatInt(w.Replicas()))
+	return nil
+}
+
+func (r *run) applyHPA(ctx context.Context, hpa HPA) error {
+	current := FormatInt32(hpa.Spec.MinReplicas)
+	annotations := annotationsOf(hpa)
+
+	if r.action == ActionSleep {
+		if r.Sleep.HPAStrategy == HPAStrategyDelete {
+			return r.sleepHPAByDelete(ctx, hpa)
+		}
+
+		// Preserve minReplicas so wake can revert to the prior value.
+		target := defaultInt32(r.Sleep.HPAMinReplicas, 1)
+		entry := r.snap.entry(KindHPA, hpa.Name)
+		if hpa.Spec.MinReplicas != nil {
+			recordOriginal(annotations, AnnotationOriginalHPAMin, *hpa.Spec.MinReplicas, target)
+			entry.MinReplicas = keepRecorded(entry.MinReplicas, *hpa.Spec.MinReplicas, target)
+		}
+		hpa.Spec.MinReplicas = &target
+		resourceVersion, err := hpa.update(ctx, r.Client, r.updateOptions())
+		if err != nil {
+			return err
+		}
+		entry.ResourceVersion = resourceVersion
+		r.record(hpa, "minReplicas", current, formatInt(target))
+		return nil
+	}
+
+	r.warnIfChanged(hpa)
+	recorded := r.snap.recorded(KindHPA, hpa.Name)
+	target := restoreOriginal(annotations, AnnotationOriginalHPAMin, firstInt32(r.Wake.HPAMinReplicas, recorded.MinReplicas))
+	if target == nil {
+		return nil
+	}
+	hpa.Spec.MinReplicas = target
+	if _, err := hpa.update(ctx, r.Client, r.updateOptions()); err != nil {
+		return err
+	}
+	r.snap.forget(KindHPA, hpa.Name)
+	r.record(hpa, "minReplicas", current, FormatInt32(target))
+	return nil
+}
+
+func (r *run) applyCronJob(ctx context.Context, cronJob CronJob) error {
+	live := cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend
+	suspend := r.Wake.SuspendCronJobs
+	if recorded := r.snap.recorded(KindCronJob, cronJob.Name).Suspend; recorded != nil {
+		// Wake restores the value sleep found, so a manual suspend survives.
+		suspend = *recorded
+	}
+	if r.action == ActionSleep {
+		suspend = r.Sleep.SuspendCronJobs
+		entry := r.snap.entry(KindCronJob, cronJob.Name)
+		if entry.Suspend == nil || live != suspend {
+			entry.Suspend = &live
+		}
+	}
+
+	cronJob.Spec.Suspend = &suspend
+	resourceVersion, err := cronJob.update(ctx, r.Client, r.updateOptions())
+	if err != nil {
+		return err
+	}
+	if r.action == ActionSleep {
+		r.snap.entry(KindCronJob, cronJob.Name).ResourceVersion = resourceVersion
+	} else {
+		r.snap.forget(KindCronJob, cronJob.Name)
+	}
+	r.record(cronJob, "suspend", strconv.FormatBool(live), strconv.FormatBool(suspend))
+	return nil
+}
+
+func (r *run) updateOptions() metav1.UpdateOptions {
+	if r.DryRun {
+		return metav1.UpdateOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.UpdateOptions{}
+}
+
+func (r *run) createOptions() metav1.CreateOptions {
+	if r.DryRun {
+		return metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.CreateOptions{}
+}
+
+func (r *run) deleteOptions() metav1.DeleteOptions {
+	if r.DryRun {
+		return metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.DeleteOptions{}
+}
+
+// record notes a change; values that did not move are skipped.
+func (r *run) record(w Workload, field, from, to string) {
+	if from == to {
+		return
+	}
+	r.result.Changes = append(r.result.Changes, Change{Kind: w.Kind(), Name: w.GetName(), Field: field, From: from, To: to})
+}
+
+// warnIfChanged reports objects modified after sleep recorded them, which is
+// usually a re-apply that also wiped the annotations.
+func (r *run) warnIfChanged(w Workload) {
+	recorded := r.snap.recorded(w.Kind(), w.GetName())
+	if recorded.ResourceVersion != "" && recorded.ResourceVersion != w.GetResourceVersion() {
+		r.logf("%s %s changed since sleep (resourceVersion %s -> %s)", w.Kind(), w.GetName(), recorded.ResourceVersion, w.GetResourceVersion())
+	}
+}
+
+func (e *Engine) logf(format string, args ...interface{}) {
+	if e.Logf != nil {
+		e.Logf(format, args...)
+	}
+}
+
+// ignoreNotFound treats an already-deleted object as done.
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// FromKubeSnooze returns an engine and target for a KubeSnooze, resolved the
+// same way the controller configures the runner.
+func FromKubeSnooze(clientset kubernetes.Interface, snooze *kubesnoozev1alpha1.KubeSnooze) (*Engine, Target, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&snooze.Spec.Selector)
+	if err != nil {
+		return nil, Target{}, err
+	}
+	engine := &Engine{
+		Client: clientset,
+		Sleep:  SleepBehaviorFromSpec(snooze.Spec.Sleep),
+		Wake:   BehaviorFromSpec(snooze.Spec.Wake, false),
+	}
+	if !SuspendsCronJobs(snooze.Spec) {
+		// Nothing to suspend or resume; the runner Role has no CronJob access.
+		engine.Sleep.SkipCronJobs = true
+		engine.Wake.SkipCronJobs = true
+	}
+	target := Target{
+		Namespace:    snooze.Namespace,
+		Selectors:    []labels.Selector{selector},
+		SnapshotName: SnapshotConfigMapName(snooze.Name),
+	}
+	return engine, target, nil
+}
+
+// BehaviorFromSpec resolves a SnoozeBehavior; suspendDefault applies when
+// SuspendCronJobs is unset (true for sleep, false for wake).
+func BehaviorFromSpec(spec kubesnoozev1alpha1.SnoozeBehavior, suspendDefault bool) Behavior {
+	behavior := Behavior{
+		Replicas:        spec.Replicas,
+		HPAMinReplicas:  spec.HPAMinReplicas,
+		SuspendCronJobs: suspendDefault,
+	}
+	if spec.SuspendCronJobs != nil {
+		behavior.SuspendCronJobs = *spec.SuspendCronJobs
+	}
+	return behavior
+}
+
+// SleepBehaviorFromSpec resolves the sleep behavior, including its HPA strategy.
+func SleepBehaviorFromSpec(spec kubesnoozev1alpha1.SleepBehavior) Behavior {
+	behavior := BehaviorFromSpec(spec.SnoozeBehavior, true)
+	behavior.HPAStrategy = spec.HPAStrategy
+	return behavior
+}
+
+// SuspendsCronJobs reports whether sleep or wake of spec suspends CronJobs.
+// When neither does, runs leave CronJobs alone.
+func SuspendsCronJobs(spec kubesnoozev1alpha1.KubeSnoozeSpec) bool {
+	return SleepBehaviorFromSpec(spec.Sleep).SuspendCronJobs || BehaviorFromSpec(spec.Wake, false).SuspendCronJobs
+}
+
+// SnapshotConfigMapName is the snapshot ConfigMap the controller creates for a KubeSnooze.
+func SnapshotConfigMapName(name string) string {
+	return fmt.Sprintf("kubesnooze-%s-snapshot", name)
+}
+
+// recordOriginal stores the live value under key before a sleep. A workload
+// already sitting at the sleep target keeps its recorded value, since that is
+// the only trace of its pre-sleep state; otherwise the live value wins so that
+// scaling done while awake is not lost to a stale annotation.
+func recordOriginal(annotations map[string]string, key string, live, sleepTarget int32) {
+	if _, ok := annotations[key]; ok && live == sleepTarget {
+		return
+	}
+	annotations[key] = strconv.Itoa(int(live))
+}
+
+// restoreOriginal resolves the wake target, preferring the configured override
+// over the recorded value, and clears the annotation once a target is known so
+// the next sleep records a fresh baseline.
+func restoreOriginal(annotations map[string]string, key string, override *int32) *int32 {
+	target := override
+	if target == nil {
+		target = ParseInt32Pointer(annotations[key])
+	}
+	if target != nil {
+		delete(annotations, key)
+	}
+	return target
+}
+
+// ParseInt32Pointer parses an optional integer setting; empty or invalid input yields nil.
+func ParseInt32Pointer(value string) *int32 {
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	result := int32(parsed)
+	return &result
+}
+
+// FormatInt32 renders an optional integer for display.
+func FormatInt32(value *int32) string {
+	if value == nil {
+		return "-"
+	}
+	return formatInt(*value)
+}
+
+func formatInt(value int32) string {
+	return strconv.Itoa(int(value))
+}
+
+func defaultInt32(value *int32, defaultValue int32) int32 {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+func int32Ptr(value int32) *int32 {
+	return &value
+}
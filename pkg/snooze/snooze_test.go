@@ -0,0 +1,180 @@
+package snooze
+
+import (
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordOriginal(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		live        int32
+		sleepTarget int32
+		want        string
+	}{
+		{
+			name:        "records when missing",
+			annotations: map[string]string{},
+			live:        3,
+			sleepTarget: 0,
+			want:        "3",
+		},
+		{
+			name:        "refreshes stale value on awake workload",
+			annotations: map[string]string{AnnotationOriginalReplicas: "2"},
+			live:        5,
+			sleepTarget: 0,
+			want:        "5",
+		},
+		{
+			name:        "keeps value when already asleep",
+			annotations: map[string]string{AnnotationOriginalReplicas: "4"},
+			live:        0,
+			sleepTarget: 0,
+			want:        "4",
+		},
+		{
+			name:        "records live value when asleep without annotation",
+			annotations: map[string]string{},
+			live:        0,
+			sleepTarget: 0,
+			want:        "0",
+		},
+		{
+			name:        "keeps value at non-zero sleep target",
+			annotations: map[string]string{AnnotationOriginalReplicas: "6"},
+			live:        1,
+			sleepTarget: 1,
+			want:        "6",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordOriginal(tt.annotations, AnnotationOriginalReplicas, tt.live, tt.sleepTarget)
+			if got := tt.annotations[AnnotationOriginalReplicas]; got != tt.want {
+				t.Errorf("annotation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreOriginal(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		override    *int32
+		want        *int32
+		wantKept    bool
+	}{
+		{
+			name:        "restores recorded value",
+			annotations: map[string]string{AnnotationOriginalReplicas: "5"},
+			want:        int32Ptr(5),
+		},
+		{
+			name:        "override wins over recorded value",
+			annotations: map[string]string{AnnotationOriginalReplicas: "5"},
+			override:    int32Ptr(2),
+			want:        int32Ptr(2),
+		},
+		{
+			name:        "nothing recorded and no override",
+			annotations: map[string]string{},
+		},
+		{
+			name:        "keeps unparsable value without override",
+			annotations: map[string]string{AnnotationOriginalReplicas: "many"},
+			wantKept:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := restoreOriginal(tt.annotations, AnnotationOriginalReplicas, tt.override)
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("target = %d, want nil", *got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Errorf("target = %v, want %d", got, *tt.want)
+			}
+			if _, ok := tt.annotations[AnnotationOriginalReplicas]; ok != tt.wantKept {
+				t.Errorf("annotation present = %t, want %t", ok, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestHPASnapshotRoundTrip(t *testing.T) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "web",
+			Labels: map[string]string{"app": "web"},
+			Annotations: map[string]string{
+				AnnotationOriginalHPAMin: "3",
+				"team":                   "payments",
+			},
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "web"},
+			MinReplicas:    int32Ptr(1),
+			MaxReplicas:    10,
+		},
+	}
+
+	raw, err := encodeHPASnapshot(hpaSnapshot(hpa))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	restored, err := decodeHPASnapshot(map[string]string{AnnotationHPASnapshot: raw})
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if restored.Name != "web" || restored.Labels["app"] != "web" {
+		t.Errorf("metadata not preserved: %+v", restored.ObjectMeta)
+	}
+	if restored.Spec.MinReplicas == nil || *restored.Spec.MinReplicas != 3 {
+		t.Errorf("minReplicas = %v, want original 3", restored.Spec.MinReplicas)
+	}
+	if restored.Spec.MaxReplicas != 10 {
+		t.Errorf("maxReplicas = %d, want 10", restored.Spec.MaxReplicas)
+	}
+	if _, ok := restored.Annotations[AnnotationOriginalHPAMin]; ok {
+		t.Error("snapshot should not carry the original-hpa-min-replicas annotation")
+	}
+	if restored.Annotations["team"] != "payments" {
+		t.Error("unrelated annotations should be preserved")
+	}
+
+	missing, err := decodeHPASnapshot(map[string]string{})
+	if err != nil || missing != nil {
+		t.Errorf("decode without annotation = %v, %v; want nil, nil", missing, err)
+	}
+}
+
+func TestKeepRecorded(t *testing.T) {
+	tests := []struct {
+		name        string
+		recorded    *int32
+		live        int32
+		sleepTarget int32
+		want        int32
+	}{
+		{name: "records live when missing", live: 3, want: 3},
+		{name: "keeps recorded while asleep", recorded: int32Ptr(4), live: 0, want: 4},
+		{name: "refreshes on drift", recorded: int32Ptr(2), live: 5, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keepRecorded(tt.recorded, tt.live, tt.sleepTarget)
+			if got == nil || *got != tt.want {
+				t.Errorf("keepRecorded = %v, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package snooze
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+	KindHPA         = "HorizontalPodAutoscaler"
+	KindCronJob     = "CronJob"
+)
+
+// Workload is an object the engine puts to sleep and wakes: Deployments and
+// StatefulSets are scaled, HPAs have minReplicas lowered or are removed, and
+// CronJobs are suspended. The set of implementations is closed.
+type Workload interface {
+	metav1.Object
+	Kind() string
+	update(ctx context.Context, clientset kubernetes.Interface, opts metav1.UpdateOptions) (string, error)
+}
+
+// Scalable is a Workload with a replica count.
+type Scalable interface {
+	Workload
+	// Replicas returns the desired replicas, defaulting to 1 like the API server.
+	Replicas() int32
+	SetReplicas(replicas int32)
+}
+
+// Deployment wraps an apps/v1 Deployment as a Scalable.
+type Deployment struct{ *appsv1.Deployment }
+
+func (Deployment) Kind() string { return KindDeployment }
+
+func (d Deployment) Replicas() int32 { return defaultInt32(d.Spec.Replicas, 1) }
+
+func (d Deployment) SetReplicas(replicas int32) { d.Spec.Replicas = &replicas }
+
+func (d Deployment) update(ctx context.Context, clientset kubernetes.Interface, opts metav1.UpdateOptions) (string, error) {
+	updated, err := clientset.AppsV1().Deployments(d.Namespace).Update(ctx, d.Deployment, opts)
+	if err != nil {
+		return "", err
+	}
+	return updated.ResourceVersion, nil
+}
+
+// StatefulSet wraps an apps/v1 StatefulSet as a Scalable.
+type StatefulSet struct{ *appsv1.StatefulSet }
+
+func (StatefulSet) Kind() string { return KindStatefulSet }
+
+func (s StatefulSet) Replicas() int32 { return defaultInt32(s.Spec.Replicas, 1) }
+
+func (s StatefulSet) SetReplicas(replicas int32) { s.Spec.Replicas = &replicas }
+
+func (s StatefulSet) update(ctx context.Context, clientset kubernetes.Interface, opts metav1.UpdateOptions) (string, error) {
+	updated, err := clientset.AppsV1().StatefulSets(s.Namespace).Update(ctx, s.StatefulSet, opts)
+	if err != nil {
+		return "", err
+	}
+	return updated.ResourceVersion, nil
+}
+
+// HPA wraps an autoscaling/v2 HorizontalPodAutoscaler as a Workload.
+type HPA struct {
+	*autoscalingv2.HorizontalPodAutoscaler
+}
+
+func (HPA) Kind() string { return KindHPA }
+
+func (h HPA) update(ctx context.Context, clientset kubernetes.Interface, opts metav1.UpdateOptions) (string, error) {
+	updated, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(h.Namespace).Update(ctx, h.HorizontalPodAutoscaler, opts)
+	if err != nil {
+		return "", err
+	}
+	return updated.ResourceVersion, nil
+}
+
+// CronJob wraps a batch/v1 CronJob as a Workload.
+type CronJob struct{ *batchv1.CronJob }
+
+func (CronJob) Kind() string { return KindCronJob }
+
+func (c CronJob) update(ctx context.Context, clientset kubernetes.Interface, opts metav1.UpdateOptions) (string, error) {
+	updated, err := clientset.BatchV1().CronJobs(c.Namespace).Update(ctx, c.CronJob, opts)
+	if err != nil {
+		return "", err
+	}
+	return updated.ResourceVersion, nil
+}
+
+// Workloads lists the objects a selector picks in a namespace, in the order
+// Apply handles them.
+func (e *Engine) Workloads(ctx context.Context, namespace string, selector labels.Selector) ([]Workload, error) {
+	var workloads []Workload
+	scalables, err := listScalables(ctx, e.Client, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, scalable := range scalables {
+		workloads = append(workloads, scalable)
+	}
+	hpas, err := listHPAs(ctx, e.Client, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, hpa := range hpas {
+		workloads = append(workloads, hpa)
+	}
+	cronJobs, err := listCronJobs(ctx, e.Client, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, cronJob := range cronJobs {
+		workloads = append(workloads, cronJob)
+	}
+	return workloads, nil
+}
+
+// listScalables returns Deployments then StatefulSets; a nil selector lists everything.
+func listScalables(ctx context.Context, clientset kubernetes.Interface, namespace string, selector labels.Selector) ([]Scalable, error) {
+	options := listOptions(selector)
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	statefulsets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	scalables := make([]Scalable, 0, len(deployments.Items)+len(statefulsets.Items))
+	for i := range deployments.Items {
+		scalables = append(scalables, Deployment{&deployments.Items[i]})
+	}
+	for i := range statefulsets.Items {
+		scalables = append(scalables, StatefulSet{&statefulsets.Items[i]})
+	}
+	return scalables, nil
+}
+
+func listHPAs(ctx context.Context, clientset kubernetes.Interface, namespace string, selector labels.Selector) ([]HPA, error) {
+	list, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(ctx, listOptions(selector))
+	if err != nil {
+		return nil, err
+	}
+	hpas := make([]HPA, 0, len(list.Items))
+	for i := range list.Items {
+		hpas = append(hpas, HPA{&list.Items[i]})
+	}
+	return hpas, nil
+}
+
+func listCronJobs(ctx context.Context, clientset kubernetes.Interface, namespace string, selector labels.Selector) ([]CronJob, error) {
+	list, err := clientset.BatchV1().CronJobs(namespace).List(ctx, listOptions(selector))
+	if err != nil {
+		return nil, err
+	}
+	cronJobs := make([]CronJob, 0, len(list.Items))
+	for i := range list.Items {
+		cronJobs = append(cronJobs, CronJob{&list.Items[i]})
+	}
+	return cronJobs, nil
+}
+
+// getScalable fetches the object an HPA scales.
+func getScalable(ctx context.Context, clientset kubernetes.Interface, namespace string, ref autoscalingv2.CrossVersionObjectReference) (Scalable, error) {
+	switch ref.Kind {
+	case KindDeployment:
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return Deployment{deployment}, nil
+	case KindStatefulSet:
+		statefulset, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return StatefulSet{statefulset}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scale target kind %q", ref.Kind)
+	}
+}
+
+func listOptions(selector labels.Selector) metav1.ListOptions {
+	if selector == nil {
+		return metav1.ListOptions{}
+	}
+	return metav1.ListOptions{LabelSelector: selector.String()}
+}
+
+// annotationsOf returns the object's annotations, creating the map if needed
+// so callers can write to it in place.
+func annotationsOf(obj metav1.Object) map[string]string {
+	if obj.GetAnnotations() == nil {
+		obj.SetAnnotations(map[string]string{})
+	}
+	return obj.GetAnnotations()
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	"kubesnooze/pkg/cron"
+	"kubesnooze/pkg/snooze"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const usage = `Usage: kubectl snooze [flags] COMMAND
+
+Commands:
+  list                      List KubeSnoozes with their state and next transitions
+  sleep NAME                Put the workloads of a KubeSnooze to sleep now
+  wake NAME                 Wake the workloads of a KubeSnooze now
+  status NAME               Show workloads with their current and original values
+  postpone NAME DURATION    Hold scheduled sleeps back for DURATION (e.g. 2h, 0 clears)
+  plan NAME [sleep|wake]    Dry-run the next (or given) action and show the diff
+
+Flags:
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(kubesnoozev1alpha1.AddToScheme(scheme))
+}
+
+type cli struct {
+	client        client.Client
+	clientset     kubernetes.Interface
+	namespace     string
+	allNamespaces bool
+	// kubeconfigUser is the user of the current context, for the audit trail.
+	kubeconfigUser string
+	out            io.Writer
+}
+
+func main() {
+	flags := flag.NewFlagSet("kubectl-snooze", flag.ExitOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig file.")
+	namespace := flags.String("namespace", "", "Namespace of the KubeSnooze (defaults to the current context).")
+	flags.StringVar(namespace, "n", "", "Shorthand for --namespace.")
+	allNamespaces := flags.Bool("A", false, "List KubeSnoozes in all namespaces.")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	// Accept flags before and after the command, like kubectl does.
+	var args []string
+	remaining := os.Args[1:]
+	for {
+		_ = flags.Parse(remaining)
+		remaining = flags.Args()
+		if len(remaining) == 0 {
+			break
+		}
+		args = append(args, remaining[0])
+		remaining = remaining[1:]
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		fail(err)
+	}
+	if *namespace == "" {
+		if *namespace, _, err = clientConfig.Namespace(); err != nil {
+			fail(err)
+		}
+	}
+
+	var kubeconfigUser string
+	if rawConfig, err := clientConfig.RawConfig(); err == nil {
+		if current, ok := rawConfig.Contexts[rawConfig.CurrentContext]; ok {
+			kubeconfigUser = current.AuthInfo
+		}
+	}
+
+	kubeClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fail(err)
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		fail(err)
+	}
+
+	c := &cli{
+		client:         kubeClient,
+		clientset:      clientset,
+		namespace:      *namespace,
+		allNamespaces:  *allNamespaces,
+		kubeconfigUser: kubeconfigUser,
+		out:            os.Stdout,
+	}
+	if err := c.run(context.Background(), args); err != nil {
+		fail(err)
+	}
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	command, params := args[0], args[1:]
+	switch {
+	case command == "list" && len(params) == 0:
+		return c.list(ctx)
+	case command == "sleep" && len(params) == 1:
+		return c.apply(ctx, params[0], snooze.ActionSleep)
+	case command == "wake" && len(params) == 1:
+		return c.apply(ctx, params[0], snooze.ActionWake)
+	case command == "status" && len(params) == 1:
+		return c.status(ctx, params[0])
+	case command == "postpone" && len(params) == 2:
+		return c.postpone(ctx, params[0], params[1])
+	case command == "plan" && len(params) == 1:
+		return c.plan(ctx, params[0], "")
+	case command == "plan" && len(params) == 2:
+		return c.plan(ctx, params[0], snooze.Action(params[1]))
+	default:
+		return fmt.Errorf("unknown command or wrong arguments: %v (see --help)", args)
+	}
+}
+
+func (c *cli) list(ctx context.Context) error {
+	var list kubesnoozev1alpha1.KubeSnoozeList
+	var opts []client.ListOption
+	if !c.allNamespaces {
+		opts = append(opts, client.InNamespace(c.namespace))
+	}
+	if err := c.client.List(ctx, &list, opts...); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tSTATE\tNEXT SLEEP\tNEXT WAKE")
+	for i := range list.Items {
+		item := &list.Items[i]
+		nextSleep, nextWake := nextTransitions(item, now)
+		sleepColumn := formatTime(nextSleep)
+		if until, ok := postponedUntil(item, now); ok && !nextSleep.After(until) {
+			// The CronJob is suspended until then and runs the missed sleep on resume.
+			sleepColumn = formatTime(until.In(nextSleep.Location())) + " (postponed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.Namespace, item.Name, state(item), sleepColumn, formatTime(nextWake))
+	}
+	return tw.Flush()
+}
+
+func (c *cli) apply(ctx context.Context, name string, action snooze.Action) error {
+	item, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	engine, target, err := c.engine(item)
+	if err != nil {
+		return err
+	}
+	result, err := engine.Apply(ctx, action, target)
+	c.printChanges(result)
+
+	// Record the run like a scheduled one so list/status report the right
+	// state. Wakes go into the audit trail, failed ones included.
+	record := snooze.NewAuditRecord(action, snooze.SourceCLI, target, result, err)
+	record.KubeSnooze = item.Name
+	recordRun := snooze.RecordSleep
+	if action == snooze.ActionWake {
+		record.User = c.whoami(ctx)
+		recordRun = snooze.RecordWake
+	}
+	if recordErr := recordRun(ctx, c.client, client.ObjectKeyFromObject(item), record); recordErr != nil && err == nil {
+		return recordErr
+	}
+	return err
+}
+
+// whoami names the caller for the audit trail: the API server's view when it
+// serves SelfSubjectReview, otherwise the kubeconfig user.
+func (c *cli) whoami(ctx context.Context) string {
+	review, err := c.clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err == nil && review.Status.UserInfo.Username != "" {
+		return review.Status.UserInfo.Username
+	}
+	return c.kubeconfigUser
+}
+
+func (c *cli) status(ctx context.Context, name string) error {
+	item, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	engine, target, err := c.engine(item)
+	if err != nil {
+		return err
+	}
+	statuses, err := engine.Inspect(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "KubeSnooze %s/%s: %s\n\n", item.Namespace, item.Name, state(item))
+	tw := tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tFIELD\tCURRENT\tORIGINAL")
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", status.Kind, status.Name, status.Field, status.Current, status.Original)
+	}
+	return tw.Flush()
+}
+
+func (c *cli) postpone(ctx context.Context, name, rawDuration string) error {
+	duration, err := time.ParseDuration(rawDuration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", rawDuration, err)
+	}
+	item, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(item.DeepCopy())
+	if duration <= 0 {
+		delete(item.Annotations, kubesnoozev1alpha1.AnnotationPostponeUntil)
+	} else {
+		if item.Annotations == nil {
+			item.Annotations = map[string]string{}
+		}
+		item.Annotations[kubesnoozev1alpha1.AnnotationPostponeUntil] = time.Now().Add(duration).UTC().Format(time.RFC3339)
+	}
+	if err := c.client.Patch(ctx, item, patch); err != nil {
+		return err
+	}
+
+	if duration <= 0 {
+		fmt.Fprintf(c.out, "postponement cleared for %s/%s\n", item.Namespace, item.Name)
+	} else {
+		fmt.Fprintf(c.out, "sleep for %s/%s postponed until %s\n", item.Namespace, item.Name, item.Annotations[kubesnoozev1alpha1.AnnotationPostponeUntil])
+	}
+	return nil
+}
+
+func (c *cli) plan(ctx context.Context, name string, action snooze.Action) error {
+	item, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if action == "" {
+		// Default to whichever transition the schedule runs next.
+		action = snooze.ActionSleep
+		nextSleep, nextWake := nextTransitions(item, time.Now())
+		if !nextWake.IsZero() && (nextSleep.IsZero() || nextWake.Before(nextSleep)) {
+			action = snooze.ActionWake
+		}
+	}
+	engine, target, err := c.engine(item)
+	if err != nil {
+		return err
+	}
+	engine.DryRun = true
+
+	result, err := engine.Apply(ctx, action, target)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "plan for %s of %s/%s:\n", action, item.Namespace, item.Name)
+	if len(result.Changes) == 0 {
+		fmt.Fprintln(c.out, "no changes")
+		return nil
+	}
+	c.printChanges(result)
+	return nil
+}
+
+func (c *cli) get(ctx context.Context, name string) (*kubesnoozev1alpha1.KubeSnooze, error) {
+	item := &kubesnoozev1alpha1.KubeSnooze{}
+	if err := c.client.Get(ctx, client.ObjectKey{Namespace: c.namespace, Name: name}, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (c *cli) engine(item *kubesnoozev1alpha1.KubeSnooze) (*snooze.Engine, snooze.Target, error) {
+	engine, target, err := snooze.FromKubeSnooze(c.clientset, item)
+	if err != nil {
+		return nil, snooze.Target{}, err
+	}
+	engine.Logf = func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+	return engine, target, nil
+}
+
+func (c *cli) printChanges(result *snooze.Result) {
+	if result == nil {
+		return
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+	for _, change := range result.Changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s -> %s\n", change.Kind, change.Name, change.Field, change.From, change.To)
+	}
+	_ = tw.Flush()
+}
+
+// state derives whether the environment is asleep from the last recorded runs.
+func state(item *kubesnoozev1alpha1.KubeSnooze) string {
+	sleep, wake := item.Status.LastSleepTime, item.Status.LastWakeTime
+	switch {
+	case sleep == nil && wake == nil:
+		return "Unknown"
+	case wake == nil || (sleep != nil && sleep.After(wake.Time)):
+		return "Asleep"
+	default:
+		return "Awake"
+	}
+}
+
+// nextTransitions returns the next sleep and wake times in the KubeSnooze's
+// timezone; a zero time means none is scheduled or the schedule is invalid.
+func nextTransitions(item *kubesnoozev1alpha1.KubeSnooze, now time.Time) (time.Time, time.Time) {
+	loc := time.UTC
+	if item.Spec.Timezone != "" {
+		if parsed, err := time.LoadLocation(item.Spec.Timezone); err == nil {
+			loc = parsed
+		}
+	}
+	return nextRun(item.Spec.SleepCron, now.In(loc)), nextRun(item.Spec.WakeCron, now.In(loc))
+}
+
+func nextRun(expr string, now time.Time) time.Time {
+	if expr == "" {
+		return time.Time{}
+	}
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return time.Time{}
+	}
+	return schedule.Next(now)
+}
+
+func postponedUntil(item *kubesnoozev1alpha1.KubeSnooze, now time.Time) (time.Time, bool) {
+	until, err := time.Parse(time.RFC3339, item.Annotations[kubesnoozev1alpha1.AnnotationPostponeUntil])
+	if err != nil || !until.After(now) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04 MST")
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "kubectl-snooze: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	"kubesnooze/pkg/snooze"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStateAfterScheduledRuns(t *testing.T) {
+	item := &kubesnoozev1alpha1.KubeSnooze{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dev"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(item).WithStatusSubresource(item).Build()
+	key := client.ObjectKeyFromObject(item)
+	ctx := context.Background()
+	target := snooze.Target{Namespace: "dev"}
+
+	stateOf := func() string {
+		t.Helper()
+		var got kubesnoozev1alpha1.KubeSnooze
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatal(err)
+		}
+		return state(&got)
+	}
+
+	// The runner records a scheduled sleep, then the scheduled wake.
+	sleep := snooze.NewAuditRecord(snooze.ActionSleep, snooze.SourceSchedule, target, nil, nil)
+	sleep.Time = time.Now().Add(-time.Hour).UTC()
+	if err := snooze.RecordSleep(ctx, c, key, sleep); err != nil {
+		t.Fatal(err)
+	}
+	if got := stateOf(); got != "Asleep" {
+		t.Errorf("state after the scheduled sleep = %s, want Asleep", got)
+	}
+	wake := snooze.NewAuditRecord(snooze.ActionWake, snooze.SourceSchedule, target, nil, nil)
+	if err := snooze.RecordWake(ctx, c, key, wake); err != nil {
+		t.Fatal(err)
+	}
+	if got := stateOf(); got != "Awake" {
+		t.Errorf("state after the scheduled wake = %s, want Awake", got)
+	}
+}
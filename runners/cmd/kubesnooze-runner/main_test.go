@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"kubesnooze/pkg/snooze"
+)
+
+func TestLoadTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    snooze.Action
+		wantErr bool
+	}{
+		{
+			name: "sleep",
+			env:  map[string]string{envAction: "sleep", envNamespace: "dev", envLabelSelector: "tier=web", envSnapshotConfigMap: "kubesnooze-app-snapshot"},
+			want: snooze.ActionSleep,
+		},
+		{
+			name: "wake without snapshot",
+			env:  map[string]string{envAction: "wake", envNamespace: "dev", envLabelSelector: "tier=web"},
+			want: snooze.ActionWake,
+		},
+		{name: "invalid action", env: map[string]string{envAction: "nap", envNamespace: "dev", envLabelSelector: "tier=web"}, wantErr: true},
+		{name: "missing namespace", env: map[string]string{envAction: "sleep", envLabelSelector: "tier=web"}, wantErr: true},
+		{name: "missing selector", env: map[string]string{envAction: "sleep", envNamespace: "dev"}, wantErr: true},
+		{name: "invalid selector", env: map[string]string{envAction: "sleep", envNamespace: "dev", envLabelSelector: "tier in (web"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{envAction, envNamespace, envLabelSelector, envSnapshotConfigMap} {
+				t.Setenv(name, tt.env[name])
+			}
+			action, target, err := loadTarget()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadTarget() = %s, %+v; want an error", action, target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action != tt.want || target.Namespace != "dev" || len(target.Selectors) != 1 || target.Selectors[0].String() != "tier=web" {
+				t.Errorf("loadTarget() = %s, %+v", action, target)
+			}
+			if target.SnapshotName != tt.env[envSnapshotConfigMap] {
+				t.Errorf("snapshot = %q, want %q", target.SnapshotName, tt.env[envSnapshotConfigMap])
+			}
+		})
+	}
+}
+
+func TestLoadBehaviors(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantSleep snooze.Behavior
+		wantWake  snooze.Behavior
+		wantErr   bool
+	}{
+		{
+			name:      "defaults",
+			wantSleep: snooze.Behavior{SuspendCronJobs: true, HPAStrategy: snooze.HPAStrategyMinReplicas},
+		},
+		{
+			name: "explicit values",
+			env: map[string]string{
+				envSleepReplicas:        "1",
+				envWakeReplicas:         "3",
+				envSleepHPAMin:          "1",
+				envWakeHPAMin:           "2",
+				envSleepHPAStrategy:     snooze.HPAStrategyDelete,
+				envSleepSuspendCronJobs: "false",
+				envWakeSuspendCronJobs:  "true",
+			},
+			wantSleep: snooze.Behavior{Replicas: int32Ptr(1), HPAMinReplicas: int32Ptr(1), HPAStrategy: snooze.HPAStrategyDelete},
+			wantWake:  snooze.Behavior{Replicas: int32Ptr(3), HPAMinReplicas: int32Ptr(2), SuspendCronJobs: true},
+		},
+		{
+			name:      "no CronJob suspension skips CronJobs",
+			env:       map[string]string{envSleepSuspendCronJobs: "false", envWakeSuspendCronJobs: "false"},
+			wantSleep: snooze.Behavior{HPAStrategy: snooze.HPAStrategyMinReplicas, SkipCronJobs: true},
+			wantWake:  snooze.Behavior{SkipCronJobs: true},
+		},
+		{
+			name:      "unparsable booleans fall back to the defaults",
+			env:       map[string]string{envSleepSuspendCronJobs: "maybe", envWakeSuspendCronJobs: "maybe"},
+			wantSleep: snooze.Behavior{SuspendCronJobs: true, HPAStrategy: snooze.HPAStrategyMinReplicas},
+		},
+		{name: "invalid HPA strategy", env: map[string]string{envSleepHPAStrategy: "Scale"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{envSleepReplicas, envWakeReplicas, envSleepHPAMin, envWakeHPAMin, envSleepHPAStrategy, envSleepSuspendCronJobs, envWakeSuspendCronJobs} {
+				t.Setenv(name, tt.env[name])
+			}
+			sleep, wake, err := loadBehaviors()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadBehaviors() = %+v, %+v; want an error", sleep, wake)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sleep, tt.wantSleep) {
+				t.Errorf("sleep = %+v, want %+v", sleep, tt.wantSleep)
+			}
+			if !reflect.DeepEqual(wake, tt.wantWake) {
+				t.Errorf("wake = %+v, want %+v", wake, tt.wantWake)
+			}
+		})
+	}
+}
+
+func int32Ptr(value int32) *int32 {
+	return &value
+}
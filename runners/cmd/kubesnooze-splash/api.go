@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiPrefix  = "/api/v1/"
+	wakePath   = apiPrefix + "wake"
+	statusPath = apiPrefix + "status"
+	// retryAfterSeconds is how soon API clients are told to poll again.
+	retryAfterSeconds = 5
+)
+
+// statusResponse is the JSON form of the splash page.
+type statusResponse struct {
+	// State is ready, waking, asleep, in-progress, forbidden, not-found or error.
+	State          string             `json:"state"`
+	Ready          bool               `json:"ready"`
+	Message        string             `json:"message,omitempty"`
+	Environment    string             `json:"environment,omitempty"`
+	Namespace      string             `json:"namespace,omitempty"`
+	Workloads      []workloadProgress `json:"workloads"`
+	ReadyWorkloads int                `json:"readyWorkloads"`
+	LastSleep      *time.Time         `json:"lastSleep,omitempty"`
+	NextSleep      *time.Time         `json:"nextSleep,omitempty"`
+}
+
+// handleWake wakes the environment like the splash page, for API clients.
+func (s *wakeService) handleWake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, statusResponse{State: "error", Message: "use POST"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.requestTimeout)
+	defer cancel()
+
+	wakes, state, err := s.wake(ctx, r)
+	response := newStatusResponse(s.pageData(ctx, r, wakes, state, err), true)
+	code := statusCode(response)
+	if code == http.StatusServiceUnavailable && response.State != "error" {
+		// The wake was accepted; the workloads are still starting.
+		code = http.StatusAccepted
+	}
+	writeStatus(w, code, response)
+}
+
+// handleStatus reports the environment without waking it.
+func (s *wakeService) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, statusResponse{State: "error", Message: "use GET"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.requestTimeout)
+	defer cancel()
+
+	state := wakeTriggered
+	wakes, err := s.resolveWakes(ctx, r)
+	if err == nil && s.wakes.running(wakeKey(wakes)) {
+		state = wakeInProgress
+	}
+	response := newStatusResponse(s.pageData(ctx, r, wakes, state, err), false)
+	writeStatus(w, statusCode(response), response)
+}
+
+// newStatusResponse describes the page as JSON. Workloads that are not ready
+// are waking when the request woke them, and otherwise asleep unless scaled up.
+func newStatusResponse(data pageData, woke bool) statusResponse {
+	response := statusResponse{
+		State:          data.State,
+		Message:        data.Message,
+		Environment:    data.Environment,
+		Namespace:      data.Namespace,
+		Workloads:      data.Workloads,
+		ReadyWorkloads: data.ReadyWorkloads,
+		LastSleep:      data.LastSleep,
+		NextSleep:      data.NextSleep,
+	}
+	if response.Workloads == nil {
+		response.Workloads = []workloadProgress{}
+	}
+	switch data.State {
+	case "forbidden", "not-found", "error":
+		return response
+	}
+	// Targets without Deployments or StatefulSets have nothing to wait for.
+	response.Ready = data.ReadyWorkloads == len(data.Workloads)
+	switch {
+	case response.Ready:
+		response.State = "ready"
+	case data.State == "in-progress":
+	case !woke && asleep(data.Workloads):
+		response.State = "asleep"
+	default:
+		response.State = "waking"
+	}
+	return response
+}
+
+// asleep reports whether no workload is scaled up.
+func asleep(workloads []workloadProgress) bool {
+	for _, workload := range workloads {
+		if workload.Desired > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// statusCode is 200 once the environment is ready and 503 until then, so
+// clients can poll on the status alone.
+func statusCode(response statusResponse) int {
+	switch response.State {
+	case "ready":
+		return http.StatusOK
+	case "forbidden":
+		return http.StatusForbidden
+	case "not-found":
+		return http.StatusNotFound
+	}
+	return http.StatusServiceUnavailable
+}
+
+func writeStatus(w http.ResponseWriter, code int, response statusResponse) {
+	if code == http.StatusServiceUnavailable || code == http.StatusAccepted {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+	writeJSON(w, code, response)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Fprintf(os.Stderr, "write response: %v\n", err)
+	}
+}
+
+// wantsJSON reports whether the Accept header prefers JSON to HTML. Wildcards
+// keep the page, so browsers and a bare curl still get HTML.
+func wantsJSON(r *http.Request) bool {
+	jsonQ, htmlQ := 0.0, 0.0
+	for _, part := range splitHeaderList(strings.Join(r.Header.Values("Accept"), ",")) {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
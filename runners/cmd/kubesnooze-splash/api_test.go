@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kubesnooze/pkg/snooze"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWantsJSON(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                      false,
+		"*/*":                   false,
+		"application/json":      true,
+		"application/json, */*": true,
+		"text/html,application/xhtml+xml,*/*;q=0.8": false,
+		"text/html;q=0.5, application/json":         true,
+		"application/json;q=0":                      false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		if got := wantsJSON(r); got != want {
+			t.Errorf("wantsJSON(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestWakeAndStatusAPI(t *testing.T) {
+	zero := int32(0)
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "dev", Labels: map[string]string{"app": "shop"}},
+		Spec:       appsv1.DeploymentSpec{Replicas: &zero},
+	})
+	one := int32(1)
+	s := &wakeService{
+		clientset: clientset,
+		engine:    &snooze.Engine{Client: clientset, Wake: snooze.Behavior{Replicas: &one}},
+		config: &splashConfig{
+			namespace:      "dev",
+			serviceMode:    "selector",
+			selector:       labels.SelectorFromSet(labels.Set{"app": "shop"}),
+			authMode:       "none",
+			requestTimeout: time.Second,
+			wakeTimeout:    time.Second,
+		},
+		wakes: newWakeTracker(time.Minute, 10),
+	}
+	handler := s.routes()
+
+	status := func() (int, statusResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, statusPath, nil))
+		var response statusResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, response
+	}
+
+	if code, response := status(); code != http.StatusServiceUnavailable || response.State != "asleep" {
+		t.Errorf("status before wake = %d %+v, want 503 asleep", code, response)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, wakePath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET wake = %d, want 405", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, wakePath, nil))
+	var response statusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusAccepted || response.State != "waking" || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("wake = %d %+v retry-after %q, want 202 waking", rec.Code, response, rec.Header().Get("Retry-After"))
+	}
+	if err := s.wakes.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	code, response := status()
+	if code != http.StatusServiceUnavailable || response.State != "waking" {
+		t.Errorf("status while starting = %d %+v, want 503 waking", code, response)
+	}
+	if len(response.Workloads) != 1 || response.Workloads[0].Desired != 1 {
+		t.Errorf("workloads = %+v, want web at 1 replica", response.Workloads)
+	}
+
+	ctx := context.Background()
+	deployment, err := clientset.AppsV1().Deployments("dev").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment.Status.ReadyReplicas = 1
+	if _, err := clientset.AppsV1().Deployments("dev").UpdateStatus(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if code, response := status(); code != http.StatusOK || response.State != "ready" || !response.Ready {
+		t.Errorf("status when ready = %d %+v, want 200 ready", code, response)
+	}
+
+	// The splash page answers in JSON when asked to.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("splash with JSON accept = %d %q, want 200 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
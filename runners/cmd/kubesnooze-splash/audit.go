@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"kubesnooze/pkg/snooze"
+)
+
+// audit logs record as JSON with the caller filled in and, for wakes that ran
+// against a KubeSnooze, adds it to that KubeSnooze's status history.
+func (s *wakeService) audit(ctx context.Context, caller requester, wake wakeTarget, record snooze.AuditRecord) {
+	record.User, record.Groups, record.AuthMethod = caller.user, caller.groups, caller.method
+	record.SourceIP = caller.sourceIP
+	record.KubeSnooze = wake.snooze.Name
+	s.metrics.wake(record.Result)
+	if err := record.Write(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "audit log: %v\n", err)
+	}
+
+	ran := record.Result == snooze.AuditSucceeded || record.Result == snooze.AuditFailed
+	if s.history == nil || !ran || wake.snooze.Name == "" {
+		return
+	}
+	if err := snooze.RecordWake(ctx, s.history, wake.snooze, record); err != nil {
+		fmt.Fprintf(os.Stderr, "record wake of %s: %v\n", wake.snooze, err)
+	}
+}
+
+// requester is who asked for a wake, captured from the request so that the
+// wake can be audited after the request is done.
+type requester struct {
+	identity
+	sourceIP string
+}
+
+func (s *wakeService) requester(r *http.Request) requester {
+	return requester{identity: identityFrom(r.Context()), sourceIP: clientAddr(r, s.config.trustedProxies)}
+}
+
+// auditResult is how a wake that did not run is reported.
+func auditResult(state wakeState) string {
+	if state == wakeInProgress {
+		return snooze.AuditInProgress
+	}
+	return snooze.AuditCoolingDown
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+var errForbidden = errors.New("not allowed to wake this target")
+
+// identity is the caller as established by requireAuth.
+type identity struct {
+	user   string
+	groups []string
+	// method is how the caller was authenticated, for the audit log.
+	method string
+}
+
+type identityKey struct{}
+
+func withIdentity(r *http.Request, id identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+func identityFrom(ctx context.Context) identity {
+	id, _ := ctx.Value(identityKey{}).(identity)
+	return id
+}
+
+// forwardedIdentity reads the headers oauth2-proxy sets on upstream requests.
+// Any client can set them, so callers check where the request came from.
+func forwardedIdentity(r *http.Request) identity {
+	id := identity{
+		user:   r.Header.Get("X-Forwarded-Email"),
+		groups: splitHeaderList(r.Header.Get("X-Forwarded-Groups")),
+		method: "forwarded",
+	}
+	if id.user == "" {
+		id.user = r.Header.Get("X-Forwarded-User")
+	}
+	return id
+}
+
+// splitHeaderList splits a comma-separated header value.
+func splitHeaderList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// authzFile is the format of KUBESNOOZE_AUTHZ_FILE.
+type authzFile struct {
+	// AllowedServices may be named in ?service=.
+	AllowedServices []string `json:"allowedServices,omitempty"`
+	// AllowedSelectors allow any Service whose selector they match.
+	AllowedSelectors []string `json:"allowedSelectors,omitempty"`
+	// Rules, when present, additionally require the caller to be in a group
+	// of a rule that covers the Service.
+	Rules []authzFileRule `json:"rules,omitempty"`
+}
+
+type authzFileRule struct {
+	// Groups the rule applies to; "*" matches any caller.
+	Groups []string `json:"groups"`
+	// Services and Selectors limit the rule; when both are empty it covers
+	// every allowlisted Service.
+	Services  []string `json:"services,omitempty"`
+	Selectors []string `json:"selectors,omitempty"`
+}
+
+// serviceMatcher matches Services by name or by the labels they select.
+type serviceMatcher struct {
+	names     map[string]bool
+	selectors []labels.Selector
+}
+
+func newServiceMatcher(names, rawSelectors []string) (serviceMatcher, error) {
+	matcher := serviceMatcher{names: map[string]bool{}}
+	for _, name := range names {
+		matcher.names[name] = true
+	}
+	for _, raw := range rawSelectors {
+		selector, err := labels.Parse(raw)
+		if err != nil {
+			return serviceMatcher{}, fmt.Errorf("selector %q: %w", raw, err)
+		}
+		matcher.selectors = append(matcher.selectors, selector)
+	}
+	return matcher, nil
+}
+
+func (m serviceMatcher) empty() bool {
+	return len(m.names) == 0 && len(m.selectors) == 0
+}
+
+func (m serviceMatcher) matches(service *corev1.Service) bool {
+	if m.names[service.Name] {
+		return true
+	}
+	for _, selector := range m.selectors {
+		if selector.Matches(labels.Set(service.Spec.Selector)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatch reports whether a Service called name could match before it is
+// read: selectors need the Service itself. An empty matcher matches anything.
+func (m serviceMatcher) mayMatch(name string) bool {
+	return m.empty() || m.names[name] || len(m.selectors) > 0
+}
+
+type authzRule struct {
+	groups  map[string]bool
+	targets serviceMatcher
+}
+
+// authorizer decides which Services a caller may wake through ?service=.
+// A nil authorizer allows every Service.
+type authorizer struct {
+	allowed serviceMatcher
+	rules   []authzRule
+}
+
+func loadAuthorizer(path string) (*authorizer, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file authzFile
+	if err := yaml.UnmarshalStrict(raw, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	allowed, err := newServiceMatcher(file.AllowedServices, file.AllowedSelectors)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	authz := &authorizer{allowed: allowed}
+	for i, fileRule := range file.Rules {
+		if len(fileRule.Groups) == 0 {
+			return nil, fmt.Errorf("%s: rule %d has no groups", path, i)
+		}
+		targets, err := newServiceMatcher(fileRule.Services, fileRule.Selectors)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", path, i, err)
+		}
+		rule := authzRule{groups: map[string]bool{}, targets: targets}
+		for _, group := range fileRule.Groups {
+			rule.groups[group] = true
+		}
+		authz.rules = append(authz.rules, rule)
+	}
+	return authz, nil
+}
+
+// checkForwardedGroups refuses group rules in auth mode none unless trusted
+// proxies are configured: the groups would come from headers any client that
+// reaches the splash directly could set.
+func checkForwardedGroups(config *splashConfig, authz *authorizer) error {
+	if config.authMode != "none" || authz == nil || len(authz.rules) == 0 || len(config.trustedProxies) > 0 {
+		return nil
+	}
+	return fmt.Errorf("authz rules in auth mode none need %s, so only the proxy in front can assert groups", envTrustedProxyCIDRs)
+}
+
+// allowService reports whether id may wake what service selects.
+func (a *authorizer) allowService(id identity, service *corev1.Service) bool {
+	if a == nil {
+		return true
+	}
+	if !a.allowed.empty() && !a.allowed.matches(service) {
+		return false
+	}
+	if len(a.rules) == 0 {
+		return true
+	}
+	for _, rule := range a.rules {
+		if !rule.coversCaller(id) {
+			continue
+		}
+		if rule.targets.empty() || rule.targets.matches(service) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowServiceName reports whether id may wake a Service called name, as far
+// as the name alone tells. It is checked before the Service is read, so
+// callers cannot probe which Services exist.
+func (a *authorizer) allowServiceName(id identity, name string) bool {
+	if a == nil {
+		return true
+	}
+	if !a.allowed.mayMatch(name) {
+		return false
+	}
+	if len(a.rules) == 0 {
+		return true
+	}
+	for _, rule := range a.rules {
+		if rule.coversCaller(id) && rule.targets.mayMatch(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r authzRule) coversCaller(id identity) bool {
+	if r.groups["*"] {
+		return true
+	}
+	for _, group := range id.groups {
+		if r.groups[group] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testAuthz = `
+allowedServices: [web, api]
+allowedSelectors: ["tier=frontend"]
+rules:
+  - groups: [admins]
+  - groups: [team-a]
+    services: [web]
+  - groups: [team-b]
+    selectors: ["tier=frontend"]
+`
+
+func testService(name string, selector map[string]string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.ServiceSpec{Selector: selector},
+	}
+}
+
+func TestAuthorizerAllowService(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authz.yaml")
+	if err := os.WriteFile(path, []byte(testAuthz), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authz, err := loadAuthorizer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := testService("web", map[string]string{"app": "web"})
+	api := testService("api", map[string]string{"app": "api"})
+	shop := testService("shop", map[string]string{"app": "shop", "tier": "frontend"})
+	db := testService("db", map[string]string{"app": "db"})
+
+	tests := []struct {
+		name    string
+		groups  []string
+		service *corev1.Service
+		want    bool
+	}{
+		{name: "not allowlisted", groups: []string{"admins"}, service: db, want: false},
+		{name: "admins any allowlisted", groups: []string{"admins"}, service: api, want: true},
+		{name: "team-a by name", groups: []string{"team-a"}, service: web, want: true},
+		{name: "team-a other service", groups: []string{"team-a"}, service: api, want: false},
+		{name: "team-b by selector", groups: []string{"team-b"}, service: shop, want: true},
+		{name: "no groups", service: web, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authz.allowService(identity{user: "u", groups: tt.groups}, tt.service); got != tt.want {
+				t.Errorf("allowService = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var none *authorizer
+	if !none.allowService(identity{}, db) {
+		t.Error("nil authorizer denied a service")
+	}
+}
+
+func TestResolveWakesHidesServices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authz.yaml")
+	if err := os.WriteFile(path, []byte(testAuthz), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authz, err := loadAuthorizer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := testService("db", map[string]string{"app": "db"})
+	db.Namespace = "dev"
+	clientset := fake.NewSimpleClientset(db)
+	gets := 0
+	clientset.PrependReactor("get", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+	s := &wakeService{clientset: clientset, authz: authz, config: &splashConfig{namespace: "dev", serviceMode: "service"}}
+
+	tests := []struct {
+		name     string
+		groups   []string
+		service  string
+		wantGets int
+	}{
+		// team-a may only name web, so nothing else is read.
+		{name: "existing, denied by name", groups: []string{"team-a"}, service: "db"},
+		{name: "missing, denied by name", groups: []string{"team-a"}, service: "ghost"},
+		// team-b is allowed by selector, which needs the Service.
+		{name: "existing, denied by selector", groups: []string{"team-b"}, service: "db", wantGets: 1},
+		{name: "missing, checked by selector", groups: []string{"team-b"}, service: "ghost", wantGets: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gets = 0
+			r := withIdentity(httptest.NewRequest(http.MethodGet, "/?service="+tt.service, nil), identity{user: "u", groups: tt.groups})
+			_, err := s.resolveWakes(context.Background(), r)
+			if want := "not allowed to wake this target: service " + tt.service; err == nil || !errors.Is(err, errForbidden) || err.Error() != want {
+				t.Errorf("resolveWakes = %v, want %q", err, want)
+			}
+			if gets != tt.wantGets {
+				t.Errorf("service gets = %d, want %d", gets, tt.wantGets)
+			}
+		})
+	}
+}
+
+func TestLoadAuthorizerInvalid(t *testing.T) {
+	for _, content := range []string{
+		"allowedSelectors: ['a in (']",
+		"rules:\n  - services: [web]",
+		"allowedService: [web]",
+	} {
+		path := filepath.Join(t.TempDir(), "authz.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadAuthorizer(path); err == nil {
+			t.Errorf("loadAuthorizer(%q) succeeded, want error", content)
+		}
+	}
+}
+
+func TestForwardedIdentityNeedsTrustedProxy(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &wakeService{config: &splashConfig{authMode: "none", trustedProxies: []*net.IPNet{proxies}}}
+	var got identity
+	handler := s.requireAuth(func(_ http.ResponseWriter, r *http.Request) {
+		got = identityFrom(r.Context())
+	})
+
+	for remoteAddr, wantGroups := range map[string]int{"10.1.2.3:4567": 1, "192.0.2.1:4567": 0} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-Email", "eve@example.com")
+		r.Header.Set("X-Forwarded-Groups", "admins")
+		handler(httptest.NewRecorder(), r)
+		if len(got.groups) != wantGroups {
+			t.Errorf("groups from %s = %v, want %d", remoteAddr, got.groups, wantGroups)
+		}
+	}
+
+	authz := &authorizer{rules: []authzRule{{groups: map[string]bool{"admins": true}}}}
+	if err := checkForwardedGroups(s.config, authz); err != nil {
+		t.Errorf("rules behind a trusted proxy: %v", err)
+	}
+	if err := checkForwardedGroups(&splashConfig{authMode: "none"}, authz); err == nil {
+		t.Error("rules without trusted proxies were accepted in auth mode none")
+	}
+	if err := checkForwardedGroups(&splashConfig{authMode: "none"}, &authorizer{}); err != nil {
+		t.Errorf("allowlist without rules: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	envAuthHtpasswdFile   = "KUBESNOOZE_AUTH_HTPASSWD_FILE"
+	envAuthMaxFailures    = "KUBESNOOZE_AUTH_MAX_FAILURES"
+	envAuthFailureWindow  = "KUBESNOOZE_AUTH_FAILURE_WINDOW"
+	defaultMaxFailures    = 5
+	defaultFailureWindow  = time.Minute
+	htpasswdReloadPeriod  = 10 * time.Second
+	maxFailureTrackedAddr = 10000
+)
+
+// dummyHash is compared against for unknown users, so a miss costs as much
+// as a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("kubesnooze"), bcrypt.DefaultCost)
+
+// basicConfig is the basic auth mode: one user from env, or many from an
+// htpasswd file with bcrypt hashes.
+type basicConfig struct {
+	username      string
+	password      string
+	htpasswdFile  string
+	maxFailures   int
+	failureWindow time.Duration
+	// trustedProxies may name the client in X-Forwarded-For.
+	trustedProxies []*net.IPNet
+}
+
+func loadBasicConfig() (basicConfig, error) {
+	config := basicConfig{
+		username:      strings.TrimSpace(os.Getenv(envAuthUsername)),
+		password:      strings.TrimSpace(os.Getenv(envAuthPassword)),
+		htpasswdFile:  strings.TrimSpace(os.Getenv(envAuthHtpasswdFile)),
+		maxFailures:   defaultMaxFailures,
+		failureWindow: defaultFailureWindow,
+	}
+	if config.htpasswdFile == "" && (config.username == "" || config.password == "") {
+		return basicConfig{}, fmt.Errorf("%s and %s, or %s, must be set to enable login",
+			envAuthUsername, envAuthPassword, envAuthHtpasswdFile)
+	}
+	if raw := os.Getenv(envAuthMaxFailures); raw != "" {
+		failures, err := strconv.Atoi(raw)
+		if err != nil || failures < 0 {
+			return basicConfig{}, fmt.Errorf("invalid %s: %q", envAuthMaxFailures, raw)
+		}
+		config.maxFailures = failures
+	}
+	if raw := os.Getenv(envAuthFailureWindow); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			return basicConfig{}, fmt.Errorf("invalid %s: %q", envAuthFailureWindow, raw)
+		}
+		config.failureWindow = window
+	}
+	return config, nil
+}
+
+type basicAuth struct {
+	config  basicConfig
+	users   *htpasswd
+	limiter *loginLimiter
+}
+
+func newBasicAuth(config basicConfig) (*basicAuth, error) {
+	auth := &basicAuth{
+		config:  config,
+		limiter: newLoginLimiter(config.maxFailures, config.failureWindow),
+	}
+	if config.maxFailures > 0 && len(config.trustedProxies) == 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s is not set, so failed logins are counted per username and TCP peer; "+
+			"behind an ingress every client shares its address\n", envTrustedProxyCIDRs)
+	}
+	if config.htpasswdFile != "" {
+		users := &htpasswd{path: config.htpasswdFile}
+		if _, err := users.reload(); err != nil {
+			return nil, err
+		}
+		auth.users = users
+	}
+	return auth, nil
+}
+
+func (b *basicAuth) require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr := clientAddr(r, b.config.trustedProxies)
+		username, password, ok := r.BasicAuth()
+		key := b.failureKey(addr, username)
+		if wait := b.limiter.blocked(key); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second)/time.Second)+1))
+			http.Error(w, "Too many failed logins", http.StatusTooManyRequests)
+			return
+		}
+		if !ok || !b.verify(username, password) {
+			if ok {
+				b.limiter.fail(key)
+				fmt.Printf("failed login for %q from %s\n", username, addr)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="kubesnooze"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		b.limiter.succeed(key)
+		next(w, withIdentity(r, identity{user: username, method: "basic"}))
+	}
+}
+
+// failureKey is what failed logins are counted against. Without trusted
+// proxies, every client behind an ingress shares its address, so the username
+// is added and one user's failures do not lock out everyone else.
+func (b *basicAuth) failureKey(addr, username string) string {
+	if len(b.config.trustedProxies) > 0 {
+		return addr
+	}
+	return addr + "/" + strconv.Quote(username)
+}
+
+func (b *basicAuth) verify(username, password string) bool {
+	if b.users != nil {
+		return b.users.verify(username, password)
+	}
+	// Hash both sides so the comparison does not leak the lengths either.
+	userOK := constantTimeEqual(username, b.config.username)
+	passwordOK := constantTimeEqual(password, b.config.password)
+	return userOK && passwordOK
+}
+
+func constantTimeEqual(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// watch reloads the htpasswd file when it changes, until ctx is done.
+func (b *basicAuth) watch(ctx context.Context) {
+	if b.users == nil {
+		return
+	}
+	ticker := time.NewTicker(htpasswdReloadPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := b.users.reload()
+			if err != nil {
+				// Keep serving the last good file.
+				fmt.Fprintf(os.Stderr, "reload %s: %v\n", b.users.path, err)
+			} else if changed {
+				fmt.Printf("reloaded %s\n", b.users.path)
+			}
+		}
+	}
+}
+
+// htpasswd holds the users of an htpasswd file ("user:bcrypt-hash" lines).
+type htpasswd struct {
+	path string
+
+	mu       sync.RWMutex
+	contents []byte
+	hashes   map[string][]byte
+}
+
+// reload re-reads the file and reports whether its contents changed. Mounted
+// Secrets are replaced through a symlink swap, so the bytes are compared
+// rather than the modification time.
+func (h *htpasswd) reload() (bool, error) {
+	raw, err := os.ReadFile(h.path)
+	if err != nil {
+		return false, err
+	}
+	h.mu.RLock()
+	unchanged := h.hashes != nil && bytes.Equal(raw, h.contents)
+	h.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	hashes, err := parseHtpasswd(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", h.path, err)
+	}
+	h.mu.Lock()
+	h.contents, h.hashes = raw, hashes
+	h.mu.Unlock()
+	return true, nil
+}
+
+func (h *htpasswd) verify(username, password string) bool {
+	h.mu.RLock()
+	hash, ok := h.hashes[username]
+	h.mu.RUnlock()
+	if !ok {
+		hash = dummyHash
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && ok
+}
+
+func parseHtpasswd(raw []byte) (map[string][]byte, error) {
+	hashes := map[string][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: want user:hash", line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			// htpasswd -B writes bcrypt; MD5, SHA1 and crypt hashes are too weak.
+			return nil, fmt.Errorf("line %d: user %q does not have a bcrypt hash", line, user)
+		}
+		hashes[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("no users")
+	}
+	return hashes, nil
+}
+
+// loginLimiter blocks a key, usually an address, for the rest of a window
+// once it has failed maxFailures logins in it. Zero maxFailures disables the
+// limit.
+type loginLimiter struct {
+	maxFailures int
+	window      time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]failureWindow
+}
+
+type failureWindow struct {
+	start time.Time
+	count int
+}
+
+func newLoginLimiter(maxFailures int, window time.Duration) *loginLimiter {
+	return &loginLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		now:         time.Now,
+		failures:    map[string]failureWindow{},
+	}
+}
+
+// blocked returns how long key must wait before trying again, or zero.
+func (l *loginLimiter) blocked(key string) time.Duration {
+	if l.maxFailures == 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.failures[key]
+	if !ok || entry.count < l.maxFailures {
+		return 0
+	}
+	if wait := entry.start.Add(l.window).Sub(l.now()); wait > 0 {
+		return wait
+	}
+	delete(l.failures, key)
+	return 0
+}
+
+func (l *loginLimiter) fail(key string) {
+	if l.maxFailures == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	entry, ok := l.failures[key]
+	if !ok || now.Sub(entry.start) >= l.window {
+		if !ok && len(l.failures) >= maxFailureTrackedAddr {
+			l.prune(now)
+		}
+		entry = failureWindow{start: now}
+	}
+	entry.count++
+	l.failures[key] = entry
+}
+
+func (l *loginLimiter) succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+// prune drops expired windows; callers hold l.mu. If every window is live
+// the table is cleared rather than grown without bound.
+func (l *loginLimiter) prune(now time.Time) {
+	for addr, entry := range l.failures {
+		if now.Sub(entry.start) >= l.window {
+			delete(l.failures, addr)
+		}
+	}
+	if len(l.failures) >= maxFailureTrackedAddr {
+		l.failures = map[string]failureWindow{}
+	}
+}
+
+// clientAddr is the address failed logins are counted against: the TCP peer,
+// or, when the peer is a trusted proxy, the nearest untrusted hop in
+// X-Forwarded-For. Entries left of that could be set by the client.
+func clientAddr(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !inNetworks(host, trustedProxies) {
+		return host
+	}
+	hops := splitHeaderList(strings.Join(r.Header.Values("X-Forwarded-For"), ","))
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !inNetworks(hops[i], trustedProxies) {
+			if ip := net.ParseIP(hops[i]); ip != nil {
+				return ip.String()
+			}
+			break
+		}
+	}
+	return host
+}
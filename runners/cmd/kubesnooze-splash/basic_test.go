@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeHtpasswd(t *testing.T, path string, users map[string]string) {
+	t.Helper()
+	var contents []byte
+	for user, password := range users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, user+":"+string(hash)+"\n"...)
+	}
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func basicRequest(auth *basicAuth, remote, username, password string) int {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = remote
+	if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+	recorder := httptest.NewRecorder()
+	auth.require(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })(recorder, request)
+	return recorder.Code
+}
+
+func TestBasicAuthStatic(t *testing.T) {
+	auth, err := newBasicAuth(basicConfig{username: "admin", password: "changeme", maxFailures: 5, failureWindow: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		username, password string
+		want               int
+	}{
+		{"admin", "changeme", http.StatusOK},
+		{"admin", "changeme2", http.StatusUnauthorized},
+		{"admin", "change", http.StatusUnauthorized},
+		{"root", "changeme", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		if got := basicRequest(auth, "10.0.0.1:1000", tt.username, tt.password); got != tt.want {
+			t.Errorf("%q/%q: status %d, want %d", tt.username, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestBasicAuthHtpasswdReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path, map[string]string{"alice": "a-pass", "bob": "b-pass"})
+	auth, err := newBasicAuth(basicConfig{htpasswdFile: path, failureWindow: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := basicRequest(auth, "10.0.0.1:1000", "alice", "a-pass"); got != http.StatusOK {
+		t.Errorf("alice: status %d", got)
+	}
+	if got := basicRequest(auth, "10.0.0.1:1000", "bob", "a-pass"); got != http.StatusUnauthorized {
+		t.Errorf("bob with alice's password: status %d", got)
+	}
+
+	writeHtpasswd(t, path, map[string]string{"bob": "new-pass"})
+	if changed, err := auth.users.reload(); err != nil || !changed {
+		t.Fatalf("reload: changed=%v err=%v", changed, err)
+	}
+	if changed, _ := auth.users.reload(); changed {
+		t.Error("unchanged file reported as changed")
+	}
+	if got := basicRequest(auth, "10.0.0.1:1000", "alice", "a-pass"); got != http.StatusUnauthorized {
+		t.Errorf("removed user: status %d", got)
+	}
+	if got := basicRequest(auth, "10.0.0.1:1000", "bob", "new-pass"); got != http.StatusOK {
+		t.Errorf("bob after reload: status %d", got)
+	}
+
+	// A broken file keeps the last good users.
+	if err := os.WriteFile(path, []byte("bob:plaintext\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.users.reload(); err == nil {
+		t.Error("non-bcrypt hash accepted")
+	}
+	if got := basicRequest(auth, "10.0.0.1:1000", "bob", "new-pass"); got != http.StatusOK {
+		t.Errorf("bob after failed reload: status %d", got)
+	}
+}
+
+func TestBasicAuthRateLimit(t *testing.T) {
+	now := time.Date(2026, time.March, 4, 10, 0, 0, 0, time.UTC)
+	auth, err := newBasicAuth(basicConfig{username: "admin", password: "changeme", maxFailures: 2, failureWindow: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if got := basicRequest(auth, "10.0.0.1:1000", "admin", "wrong"); got != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d", i, got)
+		}
+	}
+	if got := basicRequest(auth, "10.0.0.1:2000", "admin", "changeme"); got != http.StatusTooManyRequests {
+		t.Errorf("blocked address: status %d, want 429", got)
+	}
+	if got := basicRequest(auth, "10.0.0.2:1000", "admin", "changeme"); got != http.StatusOK {
+		t.Errorf("other address: status %d", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := basicRequest(auth, "10.0.0.1:1000", "admin", "changeme"); got != http.StatusOK {
+		t.Errorf("after the window: status %d", got)
+	}
+}
+
+func TestBasicAuthRateLimitKey(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	for _, tt := range []struct {
+		name    string
+		proxies []*net.IPNet
+		want    int
+	}{
+		// Everyone behind the ingress shares its address, so only the
+		// username that failed is blocked.
+		{name: "no trusted proxies", want: http.StatusUnauthorized},
+		{name: "trusted proxies", proxies: []*net.IPNet{proxies}, want: http.StatusTooManyRequests},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := newBasicAuth(basicConfig{username: "admin", password: "changeme", maxFailures: 1, failureWindow: time.Minute, trustedProxies: tt.proxies})
+			if err != nil {
+				t.Fatal(err)
+			}
+			basicRequest(auth, "192.0.2.1:1000", "admin", "wrong")
+			if got := basicRequest(auth, "192.0.2.1:1000", "admin", "changeme"); got != http.StatusTooManyRequests {
+				t.Errorf("failed username: status %d, want 429", got)
+			}
+			if got := basicRequest(auth, "192.0.2.1:1000", "bob", "wrong"); got != tt.want {
+				t.Errorf("other username: status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+	for _, tt := range []struct {
+		name, remote, forwarded, want string
+	}{
+		{name: "direct", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted peer", remote: "203.0.113.7:5000", forwarded: "198.51.100.1", want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.0.0.5:5000", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "spoofed prefix", remote: "10.0.0.5:5000", forwarded: "1.2.3.4, 198.51.100.1, 10.0.0.9", want: "198.51.100.1"},
+		{name: "no header", remote: "10.0.0.5:5000", want: "10.0.0.5"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientAddr(request, trusted); got != tt.want {
+				t.Errorf("clientAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+const (
+	envTrustedProxyCIDRs   = "KUBESNOOZE_TRUSTED_PROXY_CIDRS"
+	envTrustedUserHeader   = "KUBESNOOZE_TRUSTED_USER_HEADER"
+	envTrustedGroupsHeader = "KUBESNOOZE_TRUSTED_GROUPS_HEADER"
+
+	defaultTrustedUserHeader   = "X-Forwarded-User"
+	defaultTrustedGroupsHeader = "X-Forwarded-Groups"
+)
+
+// headerConfig is the trusted-proxy mode: an auth gateway in front of the
+// splash asserts the caller in request headers, which are only believed when
+// the connection comes from one of the trusted networks.
+type headerConfig struct {
+	trusted      []*net.IPNet
+	userHeader   string
+	groupsHeader string
+}
+
+func loadHeaderConfig() (headerConfig, error) {
+	config := headerConfig{
+		userHeader:   textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(os.Getenv(envTrustedUserHeader))),
+		groupsHeader: textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(os.Getenv(envTrustedGroupsHeader))),
+	}
+	if config.userHeader == "" {
+		config.userHeader = defaultTrustedUserHeader
+	}
+	if config.groupsHeader == "" {
+		config.groupsHeader = defaultTrustedGroupsHeader
+	}
+
+	trusted, err := parseTrustedProxies()
+	if err != nil {
+		return headerConfig{}, err
+	}
+	if len(trusted) == 0 {
+		// Without a source restriction anyone could set the headers.
+		return headerConfig{}, fmt.Errorf("%s is required in header auth mode", envTrustedProxyCIDRs)
+	}
+	config.trusted = trusted
+	return config, nil
+}
+
+// parseTrustedProxies reads the networks whose connections may assert
+// forwarded headers.
+func parseTrustedProxies() ([]*net.IPNet, error) {
+	var trusted []*net.IPNet
+	for _, cidr := range splitList(os.Getenv(envTrustedProxyCIDRs)) {
+		if !strings.Contains(cidr, "/") {
+			// A bare address trusts that host alone.
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", envTrustedProxyCIDRs, err)
+		}
+		trusted = append(trusted, network)
+	}
+	return trusted, nil
+}
+
+func (c headerConfig) require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.trustedSource(r.RemoteAddr) {
+			fmt.Printf("rejected identity headers from untrusted address %s\n", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		user := strings.TrimSpace(r.Header.Get(c.userHeader))
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, withIdentity(r, identity{
+			user:   user,
+			groups: splitHeaderList(r.Header.Get(c.groupsHeader)),
+			method: "header",
+		}))
+	}
+}
+
+// trustedSource reports whether remoteAddr (host:port) is in a trusted network.
+func (c headerConfig) trustedSource(remoteAddr string) bool {
+	return fromNetworks(remoteAddr, c.trusted)
+}
+
+// fromNetworks reports whether remoteAddr (host:port) is in one of networks.
+func fromNetworks(remoteAddr string, networks []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return inNetworks(host, networks)
+}
+
+func inNetworks(host string, networks []*net.IPNet) bool {
+	ip := net.ParseIP(strings.TrimSpace(host))
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderAuth(t *testing.T) {
+	t.Setenv(envTrustedProxyCIDRs, "10.0.0.0/8, 192.168.1.5")
+	t.Setenv(envTrustedUserHeader, "x-auth-user")
+	config, err := loadHeaderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got identity
+	protected := config.require(func(w http.ResponseWriter, r *http.Request) {
+		got = identityFrom(r.Context())
+	})
+
+	tests := []struct {
+		name   string
+		remote string
+		user   string
+		want   int
+	}{
+		{name: "trusted network", remote: "10.1.2.3:4000", user: "dev@example.com", want: http.StatusOK},
+		{name: "trusted host", remote: "192.168.1.5:4000", user: "dev@example.com", want: http.StatusOK},
+		{name: "untrusted source", remote: "192.168.1.6:4000", user: "dev@example.com", want: http.StatusForbidden},
+		{name: "missing user", remote: "10.1.2.3:4000", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = identity{}
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remote
+			request.Header.Set("X-Auth-User", tt.user)
+			request.Header.Set("X-Forwarded-Groups", "team-a, team-b")
+			recorder := httptest.NewRecorder()
+			protected(recorder, request)
+			if recorder.Code != tt.want {
+				t.Fatalf("status %d, want %d", recorder.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && (got.user != tt.user || len(got.groups) != 2 || got.method != "header") {
+				t.Errorf("identity = %+v", got)
+			}
+		})
+	}
+}
+
+func TestLoadHeaderConfigRequiresCIDRs(t *testing.T) {
+	t.Setenv(envTrustedProxyCIDRs, "")
+	if _, err := loadHeaderConfig(); err == nil {
+		t.Error("header mode without trusted CIDRs accepted")
+	}
+	t.Setenv(envTrustedProxyCIDRs, "10.0.0.0/33")
+	if _, err := loadHeaderConfig(); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"sigs.k8s.io/yaml"
+)
+
+const envLocaleDir = "KUBESNOOZE_LOCALE_DIR"
+
+// Message keys of a catalog.
+const (
+	msgWaking      = "waking"
+	msgInProgress  = "inProgress"
+	msgForbidden   = "forbidden"
+	msgNotFound    = "notFound"
+	msgWakeFailed  = "wakeFailed"
+	msgRefreshHint = "refreshHint"
+	msgAsleepSince = "asleepSince"
+	msgNextSleep   = "nextSleep"
+	msgRequestedBy = "requestedBy"
+	msgReady       = "ready"
+)
+
+// catalog maps message keys to the text of one language.
+type catalog map[string]string
+
+// builtinCatalogs are the shipped translations. English is complete and the
+// fallback for keys another catalog lacks.
+var builtinCatalogs = map[string]catalog{
+	"en": {
+		msgWaking:      "Waking up this environment...",
+		msgInProgress:  "A wake is already in progress for this environment...",
+		msgForbidden:   "You are not allowed to wake this environment.",
+		msgNotFound:    "No environment is configured for this address.",
+		msgWakeFailed:  "wake failed",
+		msgRefreshHint: "This page will refresh automatically.",
+		msgAsleepSince: "Asleep since",
+		msgNextSleep:   "Next sleep",
+		msgRequestedBy: "Requested by",
+		msgReady:       "ready",
+	},
+	"de": {
+		msgWaking:      "Diese Umgebung wird geweckt...",
+		msgInProgress:  "Diese Umgebung wird bereits geweckt...",
+		msgForbidden:   "Sie dürfen diese Umgebung nicht wecken.",
+		msgNotFound:    "Für diese Adresse ist keine Umgebung konfiguriert.",
+		msgWakeFailed:  "Wecken fehlgeschlagen",
+		msgRefreshHint: "Diese Seite aktualisiert sich automatisch.",
+		msgAsleepSince: "Schläft seit",
+		msgNextSleep:   "Nächster Schlaf",
+		msgRequestedBy: "Angefordert von",
+		msgReady:       "bereit",
+	},
+	"es": {
+		msgWaking:      "Despertando este entorno...",
+		msgInProgress:  "Ya se está despertando este entorno...",
+		msgForbidden:   "No tiene permiso para despertar este entorno.",
+		msgNotFound:    "No hay ningún entorno configurado para esta dirección.",
+		msgWakeFailed:  "no se pudo despertar",
+		msgRefreshHint: "Esta página se actualizará automáticamente.",
+		msgAsleepSince: "Dormido desde",
+		msgNextSleep:   "Próxima suspensión",
+		msgRequestedBy: "Solicitado por",
+		msgReady:       "listos",
+	},
+	"fr": {
+		msgWaking:      "Réveil de cet environnement en cours...",
+		msgInProgress:  "Un réveil de cet environnement est déjà en cours...",
+		msgForbidden:   "Vous n'êtes pas autorisé à réveiller cet environnement.",
+		msgNotFound:    "Aucun environnement n'est configuré pour cette adresse.",
+		msgWakeFailed:  "échec du réveil",
+		msgRefreshHint: "Cette page s'actualisera automatiquement.",
+		msgAsleepSince: "En veille depuis",
+		msgNextSleep:   "Prochaine mise en veille",
+		msgRequestedBy: "Demandé par",
+		msgReady:       "prêts",
+	},
+	"ja": {
+		msgWaking:      "この環境を起動しています...",
+		msgInProgress:  "この環境はすでに起動中です...",
+		msgForbidden:   "この環境を起動する権限がありません。",
+		msgNotFound:    "このアドレスに対応する環境が設定されていません。",
+		msgWakeFailed:  "起動に失敗しました",
+		msgRefreshHint: "このページは自動的に更新されます。",
+		msgAsleepSince: "スリープ開始",
+		msgNextSleep:   "次回のスリープ",
+		msgRequestedBy: "リクエスト者",
+		msgReady:       "準備完了",
+	},
+}
+
+// defaultLocales serves the built-in catalogs when no directory is configured.
+var defaultLocales, _ = loadLocales("")
+
+// locales picks a catalog for a request from its Accept-Language.
+type locales struct {
+	tags     []language.Tag
+	catalogs []catalog
+	matcher  language.Matcher
+}
+
+// loadLocales merges the <tag>.yaml files of dir (for example pt-BR.yaml)
+// over the built-in catalogs. Each file is a map of message keys to text;
+// keys it leaves out fall back to its base language, then English.
+func loadLocales(dir string) (*locales, error) {
+	merged := map[string]catalog{}
+	for tag, messages := range builtinCatalogs {
+		merged[tag] = copyCatalog(messages)
+	}
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			tag, err := language.Parse(strings.TrimSuffix(filepath.Base(path), ".yaml"))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			messages, err := readCatalog(path)
+			if err != nil {
+				return nil, err
+			}
+			if merged[tag.String()] == nil {
+				merged[tag.String()] = catalog{}
+			}
+			for key, text := range messages {
+				merged[tag.String()][key] = text
+			}
+		}
+	}
+
+	// English goes first: the matcher falls back to the first tag.
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		if name != "en" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{"en"}, names...)
+
+	l := &locales{}
+	for _, name := range names {
+		messages := merged[name]
+		tag := language.MustParse(name)
+		// A regional catalog falls back to its language, then to English.
+		base, _ := tag.Base()
+		for _, fallback := range []catalog{merged[base.String()], merged["en"]} {
+			for key, text := range fallback {
+				if messages[key] == "" {
+					messages[key] = text
+				}
+			}
+		}
+		l.tags = append(l.tags, tag)
+		l.catalogs = append(l.catalogs, messages)
+	}
+	l.matcher = language.NewMatcher(l.tags)
+	return l, nil
+}
+
+func readCatalog(path string) (catalog, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	messages := catalog{}
+	if err := yaml.UnmarshalStrict(raw, &messages); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for key := range messages {
+		if _, ok := builtinCatalogs["en"][key]; !ok {
+			return nil, fmt.Errorf("%s: unknown message %q", path, key)
+		}
+	}
+	return messages, nil
+}
+
+func copyCatalog(messages catalog) catalog {
+	copied := make(catalog, len(messages))
+	for key, text := range messages {
+		copied[key] = text
+	}
+	return copied
+}
+
+// match returns the language tag and catalog that best fit the request.
+func (l *locales) match(r *http.Request) (string, catalog) {
+	if l == nil {
+		l = defaultLocales
+	}
+	preferred, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	_, index, confidence := l.matcher.Match(preferred...)
+	if confidence == language.No {
+		index = 0
+	}
+	return l.tags[index].String(), l.catalogs[index]
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalesMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "pt-BR.yaml"), "waking: Acordando este ambiente...\n")
+	writeFile(t, filepath.Join(dir, "de-AT.yaml"), "ready: fertig\n")
+	l, err := loadLocales(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		accept, lang, key, want string
+	}{
+		{"", "en", msgWaking, "Waking up this environment..."},
+		{"xx", "en", msgWaking, "Waking up this environment..."},
+		{"fr-CH, fr;q=0.9, en;q=0.8", "fr", msgReady, "prêts"},
+		{"ja", "ja", msgRefreshHint, "このページは自動的に更新されます。"},
+		{"pt-BR", "pt-BR", msgWaking, "Acordando este ambiente..."},
+		// Keys a custom catalog leaves out fall back to English...
+		{"pt-BR", "pt-BR", msgReady, "ready"},
+		// ...or to the language of a regional variant.
+		{"de-AT", "de-AT", msgReady, "fertig"},
+		{"de-AT", "de-AT", msgWaking, "Diese Umgebung wird geweckt..."},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", tc.accept)
+		lang, messages := l.match(r)
+		if !strings.HasPrefix(lang, tc.lang) || messages[tc.key] != tc.want {
+			t.Errorf("Accept-Language %q: %s %s = %q, want %s %q", tc.accept, lang, tc.key, messages[tc.key], tc.lang, tc.want)
+		}
+	}
+}
+
+func TestLoadLocalesInvalid(t *testing.T) {
+	for name, contents := range map[string]string{
+		"de.yaml":         "wakng: typo\n",
+		"not a tag!.yaml": "waking: hi\n",
+		"fr.yaml":         "waking: [not, text]\n",
+	} {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, name), contents)
+		if _, err := loadLocales(dir); err == nil {
+			t.Errorf("%s %q loaded", name, contents)
+		}
+	}
+}
+
+func TestBuiltinCatalogsComplete(t *testing.T) {
+	for lang, messages := range builtinCatalogs {
+		for key := range builtinCatalogs["en"] {
+			if messages[key] == "" {
+				t.Errorf("%s is missing %s", lang, key)
+			}
+		}
+	}
+}
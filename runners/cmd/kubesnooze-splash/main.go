@@ -2,64 +2,128 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
-	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	"kubesnooze/pkg/snooze"
+
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	annotationOriginalReplicas = "kubesnooze.io/original-replicas"
-	annotationOriginalHPAMin   = "kubesnooze.io/original-hpa-min-replicas"
-	envNamespace               = "KUBESNOOZE_NAMESPACE"
-	envLabelSelector           = "KUBESNOOZE_LABEL_SELECTOR"
-	envServiceMode             = "KUBESNOOZE_SERVICE_MODE"
-	envServiceName             = "KUBESNOOZE_SERVICE_NAME"
-	envAuthUsername            = "KUBESNOOZE_AUTH_USERNAME"
-	envAuthPassword            = "KUBESNOOZE_AUTH_PASSWORD"
-	envWakeReplicas            = "KUBESNOOZE_WAKE_REPLICAS"
-	envWakeHPAMin              = "KUBESNOOZE_WAKE_HPA_MIN_REPLICAS"
-	envPort                    = "KUBESNOOZE_PORT"
-	envTitle                   = "KUBESNOOZE_TITLE"
-	envMessage                 = "KUBESNOOZE_MESSAGE"
+	envNamespace     = "KUBESNOOZE_NAMESPACE"
+	envLabelSelector = "KUBESNOOZE_LABEL_SELECTOR"
+	envServiceMode   = "KUBESNOOZE_SERVICE_MODE"
+	envServiceName   = "KUBESNOOZE_SERVICE_NAME"
+	envAuthUsername  = "KUBESNOOZE_AUTH_USERNAME"
+	envAuthPassword  = "KUBESNOOZE_AUTH_PASSWORD"
+	envWakeReplicas  = "KUBESNOOZE_WAKE_REPLICAS"
+	envWakeHPAMin    = "KUBESNOOZE_WAKE_HPA_MIN_REPLICAS"
+	envPort          = "KUBESNOOZE_PORT"
+	envTitle         = "KUBESNOOZE_TITLE"
+	envMessage       = "KUBESNOOZE_MESSAGE"
+	envSnoozeName    = "KUBESNOOZE_SNOOZE_NAME"
+	envWakeCooldown  = "KUBESNOOZE_WAKE_COOLDOWN"
+	envWakeTimeout   = "KUBESNOOZE_WAKE_TIMEOUT"
+	envReqTimeout    = "KUBESNOOZE_REQUEST_TIMEOUT"
+	envWakeCacheSize = "KUBESNOOZE_WAKE_CACHE_SIZE"
+	envAuthzFile     = "KUBESNOOZE_AUTHZ_FILE"
+	envAuthMode      = "KUBESNOOZE_AUTH_MODE"
 )
 
+const (
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	defaultWakeCooldown         = 10 * time.Second
+	defaultWakeTimeout          = 2 * time.Minute
+	defaultRequestTimeout       = 10 * time.Second
+	defaultWakeCacheSize        = 1024
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(kubesnoozev1alpha1.AddToScheme(scheme))
+}
+
 type splashConfig struct {
-	namespace    string
-	selector     labels.Selector
-	selectorRaw  string
-	serviceMode  string
-	serviceName  string
-	authUsername string
-	authPassword string
-	wakeReplicas *int32
-	wakeHPAMin   *int32
-	port         string
-	title        string
-	message      string
+	namespace   string
+	selector    labels.Selector
+	selectorRaw string
+	serviceMode string
+	serviceName string
+	snoozeName  string
+	// authMode is none, basic, oidc, header or token.
+	authMode string
+	// trustedProxies may name the client in X-Forwarded-For.
+	trustedProxies []*net.IPNet
+	basic          basicConfig
+	oidc           oidcConfig
+	header         headerConfig
+	token          tokenConfig
+	wakeReplicas   *int32
+	wakeHPAMin     *int32
+	// wakeCooldown is how long a successful wake suppresses repeats per target.
+	wakeCooldown  time.Duration
+	wakeCacheSize int
+	// wakeTimeout bounds a background wake job; requestTimeout bounds the
+	// API calls a request makes to resolve targets and report progress.
+	wakeTimeout    time.Duration
+	requestTimeout time.Duration
+	// authzFile is a YAML file restricting ?service= overrides.
+	authzFile string
+	// templateDir holds an optional splash.html and static assets.
+	templateDir string
+	// localeDir holds extra or overriding message catalogs.
+	localeDir string
+	server    serverConfig
+	port      string
+	title     string
+	message   string
 }
 
 type wakeService struct {
-	clientset  *kubernetes.Clientset
-	config     *splashConfig
-	mu         sync.Mutex
-	lastWakeAt time.Time
+	clientset kubernetes.Interface
+	snoozes   client.Reader
+	engine    *snooze.Engine
+	config    *splashConfig
+	wakes     *wakeTracker
+	authz     *authorizer
+	basic     *basicAuth
+	oidc      *oidcAuth
+	tokens    *tokenAuth
+	// history writes wakes to KubeSnooze status; nil skips that.
+	history client.Client
+	page    *template.Template
+	locales *locales
+	metrics *splashMetrics
+	// ready is set once API access is verified, and cleared on shutdown.
+	ready atomic.Bool
 }
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	config, err := loadConfig()
 	if err != nil {
 		fail(err)
@@ -81,21 +145,146 @@ func main() {
 		fail(err)
 	}
 
+	authz, err := loadAuthorizer(config.authzFile)
+	if err != nil {
+		fail(err)
+	}
+	if err := checkForwardedGroups(config, authz); err != nil {
+		fail(err)
+	}
+
+	var basic *basicAuth
+	if config.authMode == "basic" {
+		if basic, err = newBasicAuth(config.basic); err != nil {
+			fail(err)
+		}
+		go basic.watch(ctx)
+	}
+
+	var oidc *oidcAuth
+	if config.authMode == "oidc" {
+		discoveryCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		oidc, err = newOIDCAuth(discoveryCtx, config.oidc, &http.Client{Timeout: 10 * time.Second})
+		cancel()
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	// KubeSnoozes are served from an informer so spec changes apply without a restart.
+	snoozes, err := startSnoozeCache(context.Background(), restConfig, config.namespace)
+	if err != nil {
+		fail(err)
+	}
+
+	page, err := loadPageTemplate(config.templateDir)
+	if err != nil {
+		fail(err)
+	}
+
+	locales, err := loadLocales(config.localeDir)
+	if err != nil {
+		fail(err)
+	}
+
+	history, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fail(err)
+	}
+
 	service := &wakeService{
 		clientset: clientset,
+		snoozes:   snoozes,
+		engine:    newEngine(clientset, config),
 		config:    config,
+		wakes:     newWakeTracker(config.wakeCooldown, config.wakeCacheSize),
+		authz:     authz,
+		basic:     basic,
+		oidc:      oidc,
+		history:   history,
+		page:      page,
+		locales:   locales,
+		metrics:   newSplashMetrics(),
+	}
+	if config.authMode == "token" {
+		service.tokens = newTokenAuth(config.token, clientset)
 	}
 
 	server := &http.Server{
-		Addr:         ":" + config.port,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		Handler:      service.routes(),
+		Addr:        ":" + config.port,
+		ReadTimeout: 5 * time.Second,
+		// Leave the handler its request timeout, plus time to write the page.
+		WriteTimeout: config.requestTimeout + 5*time.Second,
+		Handler:      securityHeaders(config.server, service.metrics.instrument(service.routes())),
+	}
+	if config.server.tls() {
+		certs, err := newCertReloader(config.server.tlsCertFile, config.server.tlsKeyFile)
+		if err != nil {
+			fail(err)
+		}
+		go certs.watch(ctx)
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.getCertificate}
+	}
+	health := &http.Server{
+		Addr:              ":" + config.server.metricsPort,
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler:           service.healthRoutes(),
+	}
+	go service.verifyAPIAccess(ctx)
+
+	errs := make(chan error, 2)
+	go func() {
+		fmt.Printf("kubesnooze splash listening on %s (tls=%t)\n", server.Addr, config.server.tls())
+		if config.server.tls() {
+			errs <- server.ListenAndServeTLS("", "")
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+	go func() {
+		fmt.Printf("health and metrics listening on %s\n", health.Addr)
+		errs <- health.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		fail(err)
+	case <-ctx.Done():
 	}
+	stop()
 
-	fmt.Printf("kubesnooze splash listening on %s\n", server.Addr)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		fail(err)
+	// Fail readiness first so traffic moves elsewhere, then let in-flight
+	// requests and wake jobs finish.
+	fmt.Println("shutting down")
+	service.ready.Store(false)
+	time.Sleep(shutdownDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.server.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "shutdown: %v\n", err)
+	}
+	// Wake jobs outlive their requests; let them finish too.
+	if err := service.wakes.wait(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "wakes still running at shutdown: %v\n", err)
+	}
+	if err := health.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "shutdown: %v\n", err)
+	}
+}
+
+// newEngine builds the engine for wakes of a Service or selector. Only a
+// KubeSnooze says what to do with CronJobs, so they are left alone here.
+func newEngine(clientset kubernetes.Interface, config *splashConfig) *snooze.Engine {
+	return &snooze.Engine{
+		Client: clientset,
+		Wake: snooze.Behavior{
+			Replicas:       config.wakeReplicas,
+			HPAMinReplicas: config.wakeHPAMin,
+			SkipCronJobs:   true,
+		},
+		Logf: func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		},
 	}
 }
 
@@ -104,82 +293,172 @@ func (s *wakeService) routes() http.Handler {
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	if s.oidc != nil {
+		mux.HandleFunc(s.oidc.callbackPath, s.oidc.handleCallback)
+		mux.HandleFunc(logoutPath, s.oidc.handleLogout)
+	}
+	if s.config.templateDir != "" {
+		mux.Handle(assetsPath, assetHandler(s.config.templateDir))
+	}
+	mux.HandleFunc(wakePath, s.requireAuth(s.handleWake))
+	mux.HandleFunc(statusPath, s.requireAuth(s.handleStatus))
 	mux.HandleFunc("/", s.requireAuth(s.handleSplash))
 	return mux
 }
 
 func (s *wakeService) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	switch s.config.authMode {
+	case "basic":
+		return s.basic.require(next)
+	case "oidc":
+		return s.oidc.require(next)
+	case "header":
+		return s.config.header.require(next)
+	case "token":
+		return s.tokens.require(next)
+	}
+	// Without login of its own the splash sits behind oauth2-proxy, if anything.
+	// Its headers are only believed on connections from the trusted proxies.
 	return func(w http.ResponseWriter, r *http.Request) {
-		if s.config.authUsername == "" && s.config.authPassword == "" {
-			next(w, r)
-			return
+		id := identity{method: "none"}
+		if fromNetworks(r.RemoteAddr, s.config.trustedProxies) {
+			id = forwardedIdentity(r)
 		}
-
-		username, password, ok := r.BasicAuth()
-		if !ok || username != s.config.authUsername || password != s.config.authPassword {
-			w.Header().Set("WWW-Authenticate", `Basic realm="kubesnooze"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next(w, r)
+		next(w, withIdentity(r, id))
 	}
 }
 
 func (s *wakeService) handleSplash(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.requestTimeout)
 	defer cancel()
 
-	// Optional per-request override for service-based wake.
-	serviceName := strings.TrimSpace(r.URL.Query().Get("service"))
-	err := s.wake(ctx, serviceName)
-	data := map[string]string{
-		"Title":   s.config.title,
-		"Message": s.config.message,
+	wakes, state, err := s.wake(ctx, r)
+	data := s.pageData(ctx, r, wakes, state, err)
+	w.Header().Set("Content-Language", data.Lang)
+	w.Header().Set("Vary", "Accept, Accept-Language")
+	if wantsJSON(r) {
+		response := newStatusResponse(data, true)
+		writeStatus(w, statusCode(response), response)
+		return
 	}
-	if err != nil {
-		data["Message"] = fmt.Sprintf("%s (wake failed: %v)", s.config.message, err)
+	switch {
+	case state == wakeInProgress:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, errForbidden):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, errNoRoute):
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
 		w.WriteHeader(http.StatusServiceUnavailable)
-	} else {
+	default:
 		w.WriteHeader(http.StatusOK)
 	}
 
-	if tplErr := splashTemplate.Execute(w, data); tplErr != nil {
+	if tplErr := s.page.Execute(w, data); tplErr != nil {
 		fmt.Fprintf(os.Stderr, "render error: %v\n", tplErr)
 	}
 }
 
-func (s *wakeService) wake(ctx context.Context, serviceOverride string) error {
-	s.mu.Lock()
-	// Throttle wake calls to avoid hammering the API on refresh loops.
-	if time.Since(s.lastWakeAt) < 10*time.Second {
-		s.mu.Unlock()
+// wake resolves what the request wakes and starts a wake job for it. The job
+// outlives the request, which returns at once; pages poll for progress. The
+// error is from resolving, or from the previous job for the same targets.
+func (s *wakeService) wake(ctx context.Context, r *http.Request) ([]wakeTarget, wakeState, error) {
+	caller := s.requester(r)
+	wakes, err := s.resolveWakes(ctx, r)
+	if err != nil {
+		record := snooze.AuditRecord{
+			Time:      time.Now().UTC(),
+			Action:    snooze.ActionWake,
+			Source:    snooze.SourceSplash,
+			Namespace: s.config.namespace,
+			Result:    snooze.AuditFailed,
+			Error:     err.Error(),
+		}
+		if errors.Is(err, errForbidden) {
+			record.Result = snooze.AuditDenied
+		}
+		s.audit(ctx, caller, wakeTarget{}, record)
+		return nil, wakeTriggered, err
+	}
+
+	state, err := s.wakes.start(wakeKey(wakes), func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.wakeTimeout)
+		defer cancel()
+		for _, wake := range wakes {
+			started := time.Now()
+			result, err := wake.engine.Apply(ctx, snooze.ActionWake, wake.target)
+			s.metrics.observeWake(time.Since(started))
+			s.audit(ctx, caller, wake, snooze.NewAuditRecord(snooze.ActionWake, snooze.SourceSplash, wake.target, result, err))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "wake %s: %v\n", wake.target.Namespace, err)
+				return err
+			}
+		}
 		return nil
+	})
+	if state != wakeTriggered {
+		for _, wake := range wakes {
+			record := snooze.NewAuditRecord(snooze.ActionWake, snooze.SourceSplash, wake.target, nil, nil)
+			record.Result = auditResult(state)
+			s.audit(ctx, caller, wake, record)
+		}
 	}
-	s.lastWakeAt = time.Now()
-	s.mu.Unlock()
+	return wakes, state, err
+}
 
-	selectors, err := resolveSelectors(ctx, s.clientset, s.config, serviceOverride)
-	if err != nil {
-		return err
+// resolveWakes works out what a request wakes.
+func (s *wakeService) resolveWakes(ctx context.Context, r *http.Request) ([]wakeTarget, error) {
+	if s.config.serviceMode == "route" {
+		routed, err := s.route(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		wake, err := s.snoozeWakeTarget(routed)
+		if err != nil {
+			return nil, err
+		}
+		return []wakeTarget{wake}, nil
 	}
-	for _, selector := range selectors {
-		if err := processDeployments(ctx, s.clientset, s.config, selector); err != nil {
-			return err
+
+	// Optional per-request override for service-based wake.
+	var serviceOverride *corev1.Service
+	if name := strings.TrimSpace(r.URL.Query().Get("service")); name != "" {
+		id := identityFrom(r.Context())
+		denied := fmt.Errorf("%w: service %s", errForbidden, name)
+		if !s.authz.allowServiceName(id, name) {
+			return nil, denied
 		}
-		if err := processStatefulSets(ctx, s.clientset, s.config, selector); err != nil {
-			return err
+		service, err := getService(ctx, s.clientset, s.config.namespace, name)
+		if err != nil {
+			// A missing Service looks the same as a forbidden one.
+			if s.authz != nil && apierrors.IsNotFound(err) {
+				return nil, denied
+			}
+			return nil, err
 		}
-		if err := processHPAs(ctx, s.clientset, s.config, selector); err != nil {
-			return err
+		if !s.authz.allowService(id, service) {
+			return nil, denied
 		}
+		serviceOverride = service
 	}
-	return nil
+	return s.wakeTargets(ctx, serviceOverride)
 }
 
 func loadConfig() (*splashConfig, error) {
+	serviceMode := strings.ToLower(strings.TrimSpace(os.Getenv(envServiceMode)))
+	if serviceMode == "route" {
+		// One splash for the whole cluster; targets come from splashRoutes.
+		return loadCommonConfig(&splashConfig{serviceMode: serviceMode})
+	}
+
 	namespace := os.Getenv(envNamespace)
 	if namespace == "" {
-		return nil, fmt.Errorf("namespace is required")
+		// Default to the namespace the splash runs in.
+		raw, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s is required outside a pod: %w", envNamespace, err)
+		}
+		namespace = strings.TrimSpace(string(raw))
 	}
 	selectorRaw := os.Getenv(envLabelSelector)
 	var selector labels.Selector
@@ -192,10 +471,12 @@ func loadConfig() (*splashConfig, error) {
 	}
 
 	serviceName := strings.TrimSpace(os.Getenv(envServiceName))
-	serviceMode := strings.ToLower(strings.TrimSpace(os.Getenv(envServiceMode)))
+	snoozeName := strings.TrimSpace(os.Getenv(envSnoozeName))
 	// Default the mode based on which inputs were provided.
 	if serviceMode == "" {
 		switch {
+		case snoozeName != "":
+			serviceMode = "snooze"
 		case serviceName != "":
 			serviceMode = "service"
 		case selector != nil:
@@ -204,8 +485,8 @@ func loadConfig() (*splashConfig, error) {
 			serviceMode = "all"
 		}
 	}
-	if serviceMode != "selector" && serviceMode != "service" && serviceMode != "all" {
-		return nil, fmt.Errorf("invalid %s: %q (use selector|service|all)", envServiceMode, serviceMode)
+	if serviceMode != "selector" && serviceMode != "service" && serviceMode != "all" && serviceMode != "snooze" {
+		return nil, fmt.Errorf("invalid %s: %q (use selector|service|all|snooze|route)", envServiceMode, serviceMode)
 	}
 	if serviceMode == "selector" && selector == nil {
 		return nil, fmt.Errorf("label selector is required when %s=selector", envServiceMode)
@@ -214,166 +495,124 @@ func loadConfig() (*splashConfig, error) {
 		return nil, fmt.Errorf("%s is required when %s=service", envServiceName, envServiceMode)
 	}
 
-	wakeReplicas := parseInt32Pointer(os.Getenv(envWakeReplicas))
-	wakeHPAMin := parseInt32Pointer(os.Getenv(envWakeHPAMin))
-	authUsername := strings.TrimSpace(os.Getenv(envAuthUsername))
-	authPassword := strings.TrimSpace(os.Getenv(envAuthPassword))
-	if (authUsername == "") != (authPassword == "") {
-		return nil, fmt.Errorf("%s and %s must both be set to enable login", envAuthUsername, envAuthPassword)
-	}
-
-	port := os.Getenv(envPort)
-	if port == "" {
-		port = "8080"
-	}
-	title := os.Getenv(envTitle)
-	if title == "" {
-		title = "KubeSnooze"
-	}
-	message := os.Getenv(envMessage)
-	if message == "" {
-		message = "Waking up this environment..."
-	}
-
-	return &splashConfig{
-		namespace:    namespace,
-		selector:     selector,
-		selectorRaw:  selectorRaw,
-		serviceMode:  serviceMode,
-		serviceName:  serviceName,
-		authUsername: authUsername,
-		authPassword: authPassword,
-		wakeReplicas: wakeReplicas,
-		wakeHPAMin:   wakeHPAMin,
-		port:         port,
-		title:        title,
-		message:      message,
-	}, nil
-}
-
-func processDeployments(ctx context.Context, clientset *kubernetes.Clientset, cfg *splashConfig, selector labels.Selector) error {
-	list, err := clientset.AppsV1().Deployments(cfg.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: selector.String(),
+	return loadCommonConfig(&splashConfig{
+		namespace:   namespace,
+		selector:    selector,
+		selectorRaw: selectorRaw,
+		serviceMode: serviceMode,
+		serviceName: serviceName,
+		snoozeName:  snoozeName,
 	})
-	if err != nil {
-		return err
-	}
-	for i := range list.Items {
-		deployment := &list.Items[i]
-		if err := wakeDeployment(ctx, clientset, cfg, deployment); err != nil {
-			return err
-		}
-	}
-	return nil
 }
 
-func processStatefulSets(ctx context.Context, clientset *kubernetes.Clientset, cfg *splashConfig, selector labels.Selector) error {
-	list, err := clientset.AppsV1().StatefulSets(cfg.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: selector.String(),
-	})
+// loadCommonConfig fills in the settings shared by every service mode.
+func loadCommonConfig(config *splashConfig) (*splashConfig, error) {
+	config.wakeReplicas = snooze.ParseInt32Pointer(os.Getenv(envWakeReplicas))
+	config.wakeHPAMin = snooze.ParseInt32Pointer(os.Getenv(envWakeHPAMin))
+	trusted, err := parseTrustedProxies()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for i := range list.Items {
-		statefulset := &list.Items[i]
-		if err := wakeStatefulSet(ctx, clientset, cfg, statefulset); err != nil {
-			return err
+	config.trustedProxies = trusted
+	config.authMode = strings.ToLower(strings.TrimSpace(os.Getenv(envAuthMode)))
+	if config.authMode == "" {
+		// Default the mode based on which credentials were provided.
+		switch {
+		case os.Getenv(envAuthUsername) != "" || os.Getenv(envAuthPassword) != "" || os.Getenv(envAuthHtpasswdFile) != "":
+			config.authMode = "basic"
+		case os.Getenv(envOIDCIssuerURL) != "":
+			config.authMode = "oidc"
+		case os.Getenv(envAuthToken) != "":
+			config.authMode = "token"
+		default:
+			config.authMode = "none"
 		}
 	}
-	return nil
-}
-
-func processHPAs(ctx context.Context, clientset *kubernetes.Clientset, cfg *splashConfig, selector labels.Selector) error {
-	list, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(cfg.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: selector.String(),
-	})
-	if err != nil {
-		return err
-	}
-	for i := range list.Items {
-		hpa := &list.Items[i]
-		if err := wakeHPAMinReplicas(ctx, clientset, cfg, hpa); err != nil {
-			return err
+	switch config.authMode {
+	case "none":
+	case "basic":
+		basic, err := loadBasicConfig()
+		if err != nil {
+			return nil, err
 		}
-	}
-	return nil
-}
-
-func wakeDeployment(ctx context.Context, clientset *kubernetes.Clientset, cfg *splashConfig, deployment *appsv1.Deployment) error {
-	if deployment.Annotations == nil {
-		deployment.Annotations = map[string]string{}
+		basic.trustedProxies = config.trustedProxies
+		config.basic = basic
+	case "oidc":
+		oidc, err := loadOIDCConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.oidc = oidc
+	case "header":
+		header, err := loadHeaderConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.header = header
+	case "token":
+		token, err := loadTokenConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.token = token
+	default:
+		return nil, fmt.Errorf("invalid %s: %q (use none|basic|oidc|header|token)", envAuthMode, config.authMode)
 	}
 
-	target := cfg.wakeReplicas
-	if target == nil {
-		if raw, ok := deployment.Annotations[annotationOriginalReplicas]; ok {
-			parsed, err := strconv.Atoi(raw)
-			if err == nil {
-				value := int32(parsed)
-				target = &value
-			}
+	config.wakeCooldown = defaultWakeCooldown
+	if raw := os.Getenv(envWakeCooldown); raw != "" {
+		cooldown, err := time.ParseDuration(raw)
+		if err != nil || cooldown < 0 {
+			return nil, fmt.Errorf("invalid %s: %q", envWakeCooldown, raw)
 		}
+		config.wakeCooldown = cooldown
 	}
-	if target != nil {
-		deployment.Spec.Replicas = target
-		_, err := clientset.AppsV1().Deployments(cfg.namespace).Update(ctx, deployment, metav1.UpdateOptions{})
-		return err
+	if config.wakeTimeout, err = durationEnv(envWakeTimeout, defaultWakeTimeout); err != nil {
+		return nil, err
 	}
-	return nil
-}
-
-func wakeStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, cfg *splashConfig, statefulset *appsv1.StatefulSet) error {
-	if statefulset.Annotations == nil {
-		statefulset.Annotations = map[string]string{}
+	if config.requestTimeout, err = durationEnv(envReqTimeout, defaultRequestTimeout); err != nil {
+		return nil, err
 	}
-
-	target := cfg.wakeReplicas
-	if target == nil {
-		if raw, ok := statefulset.Annotations[annotationOriginalReplicas]; ok {
-			parsed, err := strconv.Atoi(raw)
-			if err == nil {
-				value := int32(parsed)
-				target = &value
-			}
+	config.wakeCacheSize = defaultWakeCacheSize
+	if raw := os.Getenv(envWakeCacheSize); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid %s: %q", envWakeCacheSize, raw)
 		}
+		config.wakeCacheSize = size
 	}
-	if target != nil {
-		statefulset.Spec.Replicas = target
-		_, err := clientset.AppsV1().StatefulSets(cfg.namespace).Update(ctx, statefulset, metav1.UpdateOptions{})
-		return err
-	}
-	return nil
-}
 
-func wakeHPAMinReplicas(ctx context.Context, clientset *kubernetes.Clientset, cfg *splashConfig, hpa *autoscalingv2.HorizontalPodAutoscaler) error {
-	if hpa.Annotations == nil {
-		hpa.Annotations = map[string]string{}
-	}
+	config.authzFile = os.Getenv(envAuthzFile)
+	config.templateDir = os.Getenv(envTemplateDir)
 
-	target := cfg.wakeHPAMin
-	if target == nil {
-		if raw, ok := hpa.Annotations[annotationOriginalHPAMin]; ok {
-			parsed, err := strconv.Atoi(raw)
-			if err == nil {
-				value := int32(parsed)
-				target = &value
-			}
-		}
+	config.port = os.Getenv(envPort)
+	if config.port == "" {
+		config.port = "8080"
 	}
-	if target != nil {
-		hpa.Spec.MinReplicas = target
-		_, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(cfg.namespace).Update(ctx, hpa, metav1.UpdateOptions{})
-		return err
+	config.title = os.Getenv(envTitle)
+	if config.title == "" {
+		config.title = "KubeSnooze"
 	}
-	return nil
+	// Without a message the page shows the translated default.
+	config.message = os.Getenv(envMessage)
+	config.localeDir = os.Getenv(envLocaleDir)
+	server, err := loadServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	if server.metricsPort == config.port {
+		return nil, fmt.Errorf("%s must differ from %s", envMetricsPort, envPort)
+	}
+	config.server = server
+	return config, nil
 }
 
-func resolveSelectors(ctx context.Context, clientset *kubernetes.Clientset, cfg *splashConfig, overrideService string) ([]labels.Selector, error) {
-	if overrideService != "" {
+func resolveSelectors(ctx context.Context, clientset kubernetes.Interface, cfg *splashConfig, overrideService *corev1.Service) ([]labels.Selector, error) {
+	if overrideService != nil {
 		// Overrides the configured mode if the request specifies a service.
-		selector, err := selectorFromService(ctx, clientset, cfg.namespace, overrideService)
-		if err != nil {
-			return nil, err
+		selector := selectorFromServiceObject(overrideService)
+		if selector == nil {
+			return nil, fmt.Errorf("service %s has no selector", overrideService.Name)
 		}
 		return []labels.Selector{selector}, nil
 	}
@@ -411,12 +650,9 @@ func resolveSelectors(ctx context.Context, clientset *kubernetes.Clientset, cfg
 	}
 }
 
-func selectorFromService(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) (labels.Selector, error) {
-	service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+func selectorFromService(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (labels.Selector, error) {
+	service, err := getService(ctx, clientset, namespace, name)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil, fmt.Errorf("service %s not found in namespace %s", name, namespace)
-		}
 		return nil, err
 	}
 	selector := selectorFromServiceObject(service)
@@ -426,23 +662,20 @@ func selectorFromService(ctx context.Context, clientset *kubernetes.Clientset, n
 	return selector, nil
 }
 
-func selectorFromServiceObject(service *corev1.Service) labels.Selector {
-	if len(service.Spec.Selector) == 0 {
-		return nil
+func getService(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*corev1.Service, error) {
+	service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		// Wrapped so callers can still tell a missing Service apart.
+		return nil, fmt.Errorf("service %s in namespace %s: %w", name, namespace, err)
 	}
-	return labels.SelectorFromSet(labels.Set(service.Spec.Selector))
+	return service, nil
 }
 
-func parseInt32Pointer(value string) *int32 {
-	if value == "" {
-		return nil
-	}
-	parsed, err := strconv.Atoi(value)
-	if err != nil {
+func selectorFromServiceObject(service *corev1.Service) labels.Selector {
+	if len(service.Spec.Selector) == 0 {
 		return nil
 	}
-	result := int32(parsed)
-	return &result
+	return labels.SelectorFromSet(labels.Set(service.Spec.Selector))
 }
 
 func fail(err error) {
@@ -450,71 +683,15 @@ func fail(err error) {
 	os.Exit(1)
 }
 
-var splashTemplate = template.Must(template.New("splash").Parse(`<!DOCTYPE html>
-<html lang="en">
-<head>
-  <meta charset="UTF-8" />
-  <meta name="viewport" content="width=device-width, initial-scale=1" />
-  <title>{{ .Title }}</title>
-  <style>
-    /* Dark theme baseline with high contrast text. */
-    body {
-      margin: 0;
-      padding: 0;
-      font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
-      background: #0b1220;
-      color: #f8fafc;
-    }
-    /* Center the card both vertically and horizontally. */
-    .wrap {
-      min-height: 100vh;
-      display: flex;
-      align-items: center;
-      justify-content: center;
-      padding: 2rem;
-    }
-    /* Card container with subtle depth. */
-    .card {
-      max-width: 560px;
-      width: 100%;
-      background: #111827;
-      border-radius: 16px;
-      padding: 32px;
-      box-shadow: 0 12px 30px rgba(0, 0, 0, 0.35);
-    }
-    /* Primary message styling. */
-    h1 {
-      margin: 0 0 12px 0;
-      font-size: 28px;
-      font-weight: 700;
-    }
-    /* Supporting copy with softer contrast. */
-    p {
-      margin: 0;
-      font-size: 16px;
-      line-height: 1.6;
-      color: #cbd5f5;
-    }
-    /* Subtle hint text. */
-    .hint {
-      margin-top: 20px;
-      font-size: 13px;
-      color: #94a3b8;
-    }
-  </style>
-</head>
-<body>
-  <div class="wrap">
-    <div class="card">
-      <h1>{{ .Title }}</h1>
-      <p>{{ .Message }}</p>
-      <p class="hint">This page will refresh automatically.</p>
-    </div>
-  </div>
-  <script>
-    setTimeout(function () {
-      window.location.reload();
-    }, 12000);
-  </script>
-</body>
-</html>`))
+// durationEnv parses a positive duration from env, or returns fallback.
+func durationEnv(env string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", env, raw)
+	}
+	return value, nil
+}
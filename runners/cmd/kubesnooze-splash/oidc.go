@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	envOIDCIssuerURL     = "KUBESNOOZE_OIDC_ISSUER_URL"
+	envOIDCClientID      = "KUBESNOOZE_OIDC_CLIENT_ID"
+	envOIDCClientSecret  = "KUBESNOOZE_OIDC_CLIENT_SECRET"
+	envOIDCRedirectURL   = "KUBESNOOZE_OIDC_REDIRECT_URL"
+	envOIDCCookieSecret  = "KUBESNOOZE_OIDC_COOKIE_SECRET"
+	envOIDCScopes        = "KUBESNOOZE_OIDC_SCOPES"
+	envOIDCEmailDomains  = "KUBESNOOZE_OIDC_EMAIL_DOMAINS"
+	envOIDCAllowedGroups = "KUBESNOOZE_OIDC_ALLOWED_GROUPS"
+	envOIDCGroupsClaim   = "KUBESNOOZE_OIDC_GROUPS_CLAIM"
+	envOIDCSessionTTL    = "KUBESNOOZE_OIDC_SESSION_TTL"
+	// envOIDCAssumeEmailVerified accepts emails from providers that never send
+	// email_verified. An explicit false is still refused.
+	envOIDCAssumeEmailVerified = "KUBESNOOZE_OIDC_ASSUME_EMAIL_VERIFIED"
+
+	sessionCookie = "kubesnooze_session"
+	loginCookie   = "kubesnooze_login"
+	logoutPath    = "/logout"
+	loginTTL      = 10 * time.Minute
+)
+
+type oidcConfig struct {
+	issuerURL     string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	cookieSecret  []byte
+	scopes        []string
+	emailDomains  []string
+	allowedGroups []string
+	groupsClaim   string
+	sessionTTL    time.Duration
+	// assumeEmailVerified treats a missing email_verified claim as true.
+	assumeEmailVerified bool
+}
+
+func loadOIDCConfig() (oidcConfig, error) {
+	config := oidcConfig{
+		issuerURL:     strings.TrimSpace(os.Getenv(envOIDCIssuerURL)),
+		clientID:      strings.TrimSpace(os.Getenv(envOIDCClientID)),
+		clientSecret:  strings.TrimSpace(os.Getenv(envOIDCClientSecret)),
+		redirectURL:   strings.TrimSpace(os.Getenv(envOIDCRedirectURL)),
+		cookieSecret:  []byte(strings.TrimSpace(os.Getenv(envOIDCCookieSecret))),
+		scopes:        splitList(os.Getenv(envOIDCScopes)),
+		emailDomains:  splitList(strings.ToLower(os.Getenv(envOIDCEmailDomains))),
+		allowedGroups: splitList(os.Getenv(envOIDCAllowedGroups)),
+		groupsClaim:   strings.TrimSpace(os.Getenv(envOIDCGroupsClaim)),
+		sessionTTL:    12 * time.Hour,
+	}
+	for name, value := range map[string]string{
+		envOIDCIssuerURL:    config.issuerURL,
+		envOIDCClientID:     config.clientID,
+		envOIDCClientSecret: config.clientSecret,
+		envOIDCRedirectURL:  config.redirectURL,
+	} {
+		if value == "" {
+			return oidcConfig{}, fmt.Errorf("%s is required for OIDC login", name)
+		}
+	}
+	if len(config.cookieSecret) < 16 {
+		return oidcConfig{}, fmt.Errorf("%s must be at least 16 bytes", envOIDCCookieSecret)
+	}
+	if len(config.scopes) == 0 {
+		config.scopes = []string{"openid", "email", "profile"}
+	}
+	if config.groupsClaim == "" {
+		config.groupsClaim = "groups"
+	}
+	if raw := os.Getenv(envOIDCSessionTTL); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			return oidcConfig{}, fmt.Errorf("invalid %s: %q", envOIDCSessionTTL, raw)
+		}
+		config.sessionTTL = ttl
+	}
+	if raw := os.Getenv(envOIDCAssumeEmailVerified); raw != "" {
+		assume, err := strconv.ParseBool(raw)
+		if err != nil {
+			return oidcConfig{}, fmt.Errorf("invalid %s: %q", envOIDCAssumeEmailVerified, raw)
+		}
+		config.assumeEmailVerified = assume
+	}
+	return config, nil
+}
+
+// oidcAuth logs users in with the OIDC authorization-code flow and keeps them
+// logged in with an HMAC-signed session cookie.
+type oidcAuth struct {
+	config       oidcConfig
+	oauth2       oauth2.Config
+	verifier     *oidc.IDTokenVerifier
+	endSession   string
+	callbackPath string
+	secure       bool
+	client       *http.Client
+	now          func() time.Time
+}
+
+func newOIDCAuth(ctx context.Context, config oidcConfig, client *http.Client) (*oidcAuth, error) {
+	redirect, err := url.Parse(config.redirectURL)
+	if err != nil || redirect.Path == "" {
+		return nil, fmt.Errorf("invalid %s: %q", envOIDCRedirectURL, config.redirectURL)
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, client), config.issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// go-oidc does not model end_session_endpoint; read it from the raw document.
+	var discovery struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := provider.Claims(&discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	auth := &oidcAuth{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.clientID,
+			ClientSecret: config.clientSecret,
+			RedirectURL:  config.redirectURL,
+			Scopes:       config.scopes,
+			Endpoint:     provider.Endpoint(),
+		},
+		endSession:   discovery.EndSessionEndpoint,
+		callbackPath: redirect.Path,
+		secure:       redirect.Scheme == "https",
+		client:       client,
+		now:          time.Now,
+	}
+	auth.verifier = provider.Verifier(&oidc.Config{ClientID: config.clientID, Now: func() time.Time { return auth.now() }})
+	return auth, nil
+}
+
+// session is the payload of the session cookie.
+type session struct {
+	User    string   `json:"user"`
+	Groups  []string `json:"groups,omitempty"`
+	Expires int64    `json:"exp"`
+}
+
+// loginState ties a callback to the browser that started the login.
+type loginState struct {
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	RedirectTo string `json:"redirectTo"`
+	Expires    int64  `json:"exp"`
+}
+
+// require lets requests with a valid session through and sends the rest to
+// the issuer to log in.
+func (a *oidcAuth) require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var current session
+		if a.readCookie(r, sessionCookie, &current) && a.now().Unix() < current.Expires {
+			next(w, withIdentity(r, identity{user: current.User, groups: current.Groups, method: "oidc"}))
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		login := loginState{
+			State:      randomToken(),
+			Nonce:      randomToken(),
+			RedirectTo: r.URL.RequestURI(),
+			Expires:    a.now().Add(loginTTL).Unix(),
+		}
+		if err := a.setCookie(w, loginCookie, login, time.Unix(login.Expires, 0)); err != nil {
+			http.Error(w, "login failed", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, a.oauth2.AuthCodeURL(login.State, oauth2.SetAuthURLParam("nonce", login.Nonce)), http.StatusFound)
+	}
+}
+
+func (a *oidcAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	var login loginState
+	if !a.readCookie(r, loginCookie, &login) || a.now().Unix() >= login.Expires {
+		http.Error(w, "login expired, reload the page to try again", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("state") != login.State {
+		http.Error(w, "login state mismatch", http.StatusBadRequest)
+		return
+	}
+	a.clearCookie(w, loginCookie)
+	if providerErr := query.Get("error"); providerErr != "" {
+		http.Error(w, fmt.Sprintf("login failed: %s %s", providerErr, query.Get("error_description")), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, a.client)
+	token, err := a.oauth2.Exchange(ctx, query.Get("code"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "oidc code exchange: %v\n", err)
+		http.Error(w, "login failed", http.StatusBadGateway)
+		return
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	claims, err := a.verify(ctx, rawIDToken, login.Nonce)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "oidc id token: %v\n", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	id, err := a.authorize(claims)
+	if err != nil {
+		fmt.Printf("denied login for %q: %v\n", claims.user(), err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	current := session{User: id.user, Groups: id.groups, Expires: a.now().Add(a.config.sessionTTL).Unix()}
+	if err := a.setCookie(w, sessionCookie, current, time.Unix(current.Expires, 0)); err != nil {
+		http.Error(w, "login failed", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, localRedirect(login.RedirectTo), http.StatusFound)
+}
+
+func (a *oidcAuth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	a.clearCookie(w, sessionCookie)
+	if a.endSession != "" {
+		// End the issuer session too, or the next visit logs straight back in.
+		http.Redirect(w, r, a.endSession+"?client_id="+url.QueryEscape(a.config.clientID), http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "Signed out.")
+}
+
+// idTokenClaims are the ID token claims we use beyond what go-oidc checks.
+type idTokenClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	groups        []string
+}
+
+func (c idTokenClaims) user() string {
+	if c.Email != "" {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce
+// and returns its claims.
+func (a *oidcAuth) verify(ctx context.Context, raw, nonce string) (*idTokenClaims, error) {
+	token, err := a.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if token.Nonce != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+
+	claims := &idTokenClaims{}
+	if err := token.Claims(claims); err != nil {
+		return nil, fmt.Errorf("id token claims: %w", err)
+	}
+	var rawClaims map[string]json.RawMessage
+	if err := token.Claims(&rawClaims); err != nil {
+		return nil, fmt.Errorf("id token claims: %w", err)
+	}
+	claims.groups = stringsClaim(rawClaims[a.config.groupsClaim])
+	return claims, nil
+}
+
+// authorize applies the allowed email domains and groups.
+func (a *oidcAuth) authorize(claims *idTokenClaims) (identity, error) {
+	if len(a.config.emailDomains) > 0 && !contains(a.config.emailDomains, "*") {
+		verified := claims.EmailVerified != nil && *claims.EmailVerified
+		if claims.EmailVerified == nil {
+			// Without the claim the provider has not vouched for the address.
+			verified = a.config.assumeEmailVerified
+		}
+		if claims.Email == "" || !verified {
+			return identity{}, errors.New("no verified email")
+		}
+		domain := strings.ToLower(claims.Email[strings.LastIndex(claims.Email, "@")+1:])
+		if !contains(a.config.emailDomains, domain) {
+			return identity{}, fmt.Errorf("email domain %q not allowed", domain)
+		}
+	}
+	if len(a.config.allowedGroups) > 0 && !containsAny(a.config.allowedGroups, claims.groups) {
+		return identity{}, fmt.Errorf("groups %v not allowed", claims.groups)
+	}
+	return identity{user: claims.user(), groups: claims.groups, method: "oidc"}, nil
+}
+
+// setCookie stores value as signed JSON. The cookie name is part of the
+// signature so one cookie cannot be replayed as another.
+func (a *oidcAuth) setCookie(w http.ResponseWriter, name string, value interface{}, expires time.Time) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    encoded + "." + a.sign(name, encoded),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   a.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (a *oidcAuth) readCookie(r *http.Request, name string, value interface{}) bool {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return false
+	}
+	encoded, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(a.sign(name, encoded))) {
+		return false
+	}
+	return decodeSegment(encoded, value) == nil
+}
+
+func (a *oidcAuth) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: a.secure})
+}
+
+func (a *oidcAuth) sign(name, encoded string) string {
+	mac := hmac.New(sha256.New, a.config.cookieSecret)
+	mac.Write([]byte(name + "|" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, value)
+}
+
+// stringsClaim reads a claim holding a string or a list of strings.
+func stringsClaim(raw json.RawMessage) []string {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil && single != "" {
+		return []string{single}
+	}
+	return nil
+}
+
+// localRedirect only follows paths on this server, never other hosts.
+func localRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
+
+func randomToken() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// splitList splits a comma- or space-separated setting.
+func splitList(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, wants []string) bool {
+	for _, want := range wants {
+		if contains(values, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is a minimal OIDC provider: discovery, JWKS and a token endpoint
+// that returns an ID token with the claims the test sets.
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{key: key, claims: map[string]interface{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     issuer.sign(t, issuer.claims),
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (f *fakeIssuer) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestOIDCAuth(t *testing.T, issuer *fakeIssuer, mutate func(*oidcConfig)) *oidcAuth {
+	t.Helper()
+	config := oidcConfig{
+		issuerURL:    issuer.server.URL,
+		clientID:     "splash",
+		clientSecret: "secret",
+		redirectURL:  "https://splash.example.com/oauth2/callback",
+		cookieSecret: []byte("0123456789abcdef0123456789abcdef"),
+		scopes:       []string{"openid", "email"},
+		emailDomains: []string{"example.com"},
+		groupsClaim:  "groups",
+		sessionTTL:   time.Hour,
+	}
+	if mutate != nil {
+		mutate(&config)
+	}
+	auth, err := newOIDCAuth(context.Background(), config, issuer.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// login runs the browser side of the flow and returns the callback response.
+func login(t *testing.T, auth *oidcAuth, issuer *fakeIssuer, claims map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	protected := auth.require(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	start := httptest.NewRecorder()
+	protected(start, httptest.NewRequest(http.MethodGet, "/app?service=web", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("start: status %d, want redirect", start.Code)
+	}
+	authorize, err := url.Parse(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authorize.String(), issuer.server.URL+"/authorize") {
+		t.Fatalf("redirected to %s, want the issuer", authorize)
+	}
+
+	issuer.claims = map[string]interface{}{
+		"iss":   issuer.server.URL,
+		"aud":   "splash",
+		"sub":   "user-1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": authorize.Query().Get("nonce"),
+	}
+	for key, value := range claims {
+		issuer.claims[key] = value
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, "/oauth2/callback?code=good-code&state="+url.QueryEscape(authorize.Query().Get("state")), nil)
+	for _, cookie := range start.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	response := httptest.NewRecorder()
+	auth.handleCallback(response, callback)
+	return response
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	auth := newTestOIDCAuth(t, issuer, nil)
+
+	response := login(t, auth, issuer, map[string]interface{}{"email": "dev@example.com", "email_verified": true, "groups": []string{"team-a"}})
+	if response.Code != http.StatusFound || response.Header().Get("Location") != "/app?service=web" {
+		t.Fatalf("callback: status %d location %q", response.Code, response.Header().Get("Location"))
+	}
+
+	var got identity
+	protected := auth.require(func(w http.ResponseWriter, r *http.Request) {
+		got = identityFrom(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/app", nil)
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			request.AddCookie(cookie)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	protected(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("with session: status %d", recorder.Code)
+	}
+	if got.user != "dev@example.com" || len(got.groups) != 1 || got.groups[0] != "team-a" {
+		t.Errorf("identity = %+v", got)
+	}
+
+	// A tampered session is rejected and starts a new login.
+	tampered := httptest.NewRequest(http.MethodGet, "/app", nil)
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			cookie.Value = "x" + cookie.Value
+			tampered.AddCookie(cookie)
+		}
+	}
+	recorder = httptest.NewRecorder()
+	protected(recorder, tampered)
+	if recorder.Code != http.StatusFound {
+		t.Errorf("tampered session: status %d, want redirect", recorder.Code)
+	}
+
+	logout := httptest.NewRecorder()
+	auth.handleLogout(logout, httptest.NewRequest(http.MethodGet, logoutPath, nil))
+	cleared := false
+	for _, cookie := range logout.Result().Cookies() {
+		cleared = cleared || (cookie.Name == sessionCookie && cookie.MaxAge < 0)
+	}
+	if !cleared {
+		t.Error("logout did not clear the session cookie")
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	issuer := newFakeIssuer(t)
+
+	tests := []struct {
+		name   string
+		mutate func(*oidcConfig)
+		claims map[string]interface{}
+		want   int
+	}{
+		{name: "email domain", claims: map[string]interface{}{"email": "dev@other.com"}, want: http.StatusForbidden},
+		{name: "unverified email", claims: map[string]interface{}{"email": "dev@example.com", "email_verified": false}, want: http.StatusForbidden},
+		{name: "email not known to be verified", claims: map[string]interface{}{"email": "dev@example.com"}, want: http.StatusForbidden},
+		{
+			name:   "unverified email when assumed verified",
+			mutate: func(c *oidcConfig) { c.assumeEmailVerified = true },
+			claims: map[string]interface{}{"email": "dev@example.com", "email_verified": false},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "group",
+			mutate: func(c *oidcConfig) { c.allowedGroups = []string{"admins"} },
+			claims: map[string]interface{}{"email": "dev@example.com", "email_verified": true, "groups": []string{"team-a"}},
+			want:   http.StatusForbidden,
+		},
+		{name: "audience", claims: map[string]interface{}{"email": "dev@example.com", "aud": "other"}, want: http.StatusUnauthorized},
+		{name: "expired", claims: map[string]interface{}{"email": "dev@example.com", "exp": time.Now().Add(-time.Hour).Unix()}, want: http.StatusUnauthorized},
+		{name: "nonce", claims: map[string]interface{}{"email": "dev@example.com", "nonce": "replayed"}, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newTestOIDCAuth(t, issuer, tt.mutate)
+			if response := login(t, auth, issuer, tt.claims); response.Code != tt.want {
+				t.Errorf("callback: status %d, want %d", response.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCAssumeEmailVerified(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	auth := newTestOIDCAuth(t, issuer, func(c *oidcConfig) { c.assumeEmailVerified = true })
+	if response := login(t, auth, issuer, map[string]interface{}{"email": "dev@example.com"}); response.Code != http.StatusFound {
+		t.Errorf("callback without email_verified: status %d, want redirect", response.Code)
+	}
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	auth := newTestOIDCAuth(t, issuer, nil)
+
+	response := httptest.NewRecorder()
+	auth.handleCallback(response, httptest.NewRequest(http.MethodGet, "/oauth2/callback?code=good-code&state=forged", nil))
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("callback without login cookie: status %d, want 400", response.Code)
+	}
+}
+
+func TestLocalRedirect(t *testing.T) {
+	for target, want := range map[string]string{
+		"/app?x=1":             "/app?x=1",
+		"//evil.example.com":   "/",
+		"https://evil.example": "/",
+		"/\\evil.example.com":  "/",
+	} {
+		if got := localRedirect(target); got != want {
+			t.Errorf("localRedirect(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	"kubesnooze/pkg/cron"
+	"kubesnooze/pkg/snooze"
+)
+
+const (
+	envTemplateDir = "KUBESNOOZE_TEMPLATE_DIR"
+	// pageTemplateFile is the template looked up in the template directory.
+	pageTemplateFile = "splash.html"
+	// assetsPath serves the template directory; the prefix keeps it clear of
+	// the paths of the apps the splash stands in for.
+	assetsPath = "/_kubesnooze/assets/"
+	// refreshSeconds is how often the page reloads itself.
+	refreshSeconds = 12
+)
+
+// pageData is what splash templates render.
+type pageData struct {
+	Title   string
+	Message string
+	// State is waking, in-progress, cooling-down, forbidden, not-found or error.
+	State string
+	// Environment names what is being woken: the KubeSnoozes, or the namespace.
+	Environment string
+	Namespace   string
+	// Requester is the signed-in caller, if any.
+	Requester string
+	Workloads []workloadProgress
+	// ReadyWorkloads counts Workloads with every desired replica ready.
+	ReadyWorkloads int
+	// LastSleep and NextSleep come from the KubeSnoozes; nil when unknown.
+	LastSleep *time.Time
+	NextSleep *time.Time
+	// AssetsPath is the URL prefix of files in the template directory.
+	AssetsPath     string
+	RefreshSeconds int
+	// Lang is the language tag of the catalog T reads from.
+	Lang     string
+	messages catalog
+}
+
+// T returns the text of a message key in the page's language.
+func (p pageData) T(key string) string {
+	if text, ok := p.messages[key]; ok {
+		return text
+	}
+	return builtinCatalogs["en"][key]
+}
+
+// workloadProgress is the readiness of one scaled workload.
+type workloadProgress struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Ready   int32  `json:"ready"`
+	Desired int32  `json:"desired"`
+}
+
+// Done reports whether the workload is scaled up and fully ready.
+func (w workloadProgress) Done() bool { return w.Desired > 0 && w.Ready >= w.Desired }
+
+// Percent is the share of ready workloads, 0-100.
+func (p pageData) Percent() int {
+	if len(p.Workloads) == 0 {
+		return 0
+	}
+	return p.ReadyWorkloads * 100 / len(p.Workloads)
+}
+
+// Awake reports whether every workload is ready.
+func (p pageData) Awake() bool {
+	return len(p.Workloads) > 0 && p.ReadyWorkloads == len(p.Workloads)
+}
+
+// loadPageTemplate parses splash.html from dir, falling back to the built-in
+// page when dir is unset or only holds assets.
+func loadPageTemplate(dir string) (*template.Template, error) {
+	if dir == "" {
+		return splashTemplate, nil
+	}
+	path := filepath.Join(dir, pageTemplateFile)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return splashTemplate, nil
+	}
+	return template.New(pageTemplateFile).ParseFiles(path)
+}
+
+// assetHandler serves files from the template directory, without listings.
+func assetHandler(dir string) http.Handler {
+	files := http.StripPrefix(assetsPath, http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// pageData describes the outcome of a wake for the template.
+func (s *wakeService) pageData(ctx context.Context, r *http.Request, wakes []wakeTarget, state wakeState, err error) pageData {
+	lang, messages := s.locales.match(r)
+	data := pageData{
+		Title:          s.config.title,
+		Message:        s.config.message,
+		State:          state.String(),
+		Namespace:      s.config.namespace,
+		Requester:      identityFrom(r.Context()).user,
+		AssetsPath:     assetsPath,
+		RefreshSeconds: refreshSeconds,
+		Lang:           lang,
+		messages:       messages,
+	}
+	if data.Message == "" {
+		data.Message = data.T(msgWaking)
+	}
+	if state == wakeTriggered || state == wakeCoolingDown {
+		data.State = "waking"
+	}
+	switch {
+	case errors.Is(err, errForbidden):
+		data.State = "forbidden"
+		data.Message = data.T(msgForbidden)
+	case errors.Is(err, errNoRoute):
+		data.State = "not-found"
+		data.Message = data.T(msgNotFound)
+	case err != nil:
+		data.State = "error"
+		data.Message = fmt.Sprintf("%s (%s: %v)", data.Message, data.T(msgWakeFailed), err)
+	case state == wakeInProgress:
+		data.Message = data.T(msgInProgress)
+	}
+
+	now := time.Now()
+	var names []string
+	for _, wake := range wakes {
+		data.Namespace = wake.target.Namespace
+		data.Workloads = append(data.Workloads, s.progress(ctx, wake)...)
+		if wake.snooze.Name == "" {
+			continue
+		}
+		names = append(names, wake.snooze.Name)
+		item := kubesnoozev1alpha1.KubeSnooze{}
+		if err := s.snoozes.Get(ctx, wake.snooze, &item); err != nil {
+			continue
+		}
+		if last := item.Status.LastSleepTime; last != nil && (data.LastSleep == nil || last.After(*data.LastSleep)) {
+			data.LastSleep = &last.Time
+		}
+		if next := nextSleep(&item, now); !next.IsZero() && (data.NextSleep == nil || next.Before(*data.NextSleep)) {
+			data.NextSleep = &next
+		}
+	}
+	data.Environment = strings.Join(names, ", ")
+	if data.Environment == "" {
+		data.Environment = data.Namespace
+	}
+	for _, workload := range data.Workloads {
+		if workload.Done() {
+			data.ReadyWorkloads++
+		}
+	}
+	return data
+}
+
+// progress reports the readiness of the Deployments and StatefulSets a wake
+// targets. Listing errors leave the page without progress rather than failing it.
+func (s *wakeService) progress(ctx context.Context, wake wakeTarget) []workloadProgress {
+	var progress []workloadProgress
+	seen := map[string]bool{}
+	for _, selector := range wake.target.Selectors {
+		workloads, err := wake.engine.Workloads(ctx, wake.target.Namespace, selector)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list workloads: %v\n", err)
+			continue
+		}
+		for _, workload := range workloads {
+			var ready int32
+			switch typed := workload.(type) {
+			case snooze.Deployment:
+				ready = typed.Status.ReadyReplicas
+			case snooze.StatefulSet:
+				ready = typed.Status.ReadyReplicas
+			default:
+				continue
+			}
+			key := workload.Kind() + "/" + workload.GetName()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			progress = append(progress, workloadProgress{
+				Kind:    workload.Kind(),
+				Name:    workload.GetName(),
+				Ready:   ready,
+				Desired: workload.(snooze.Scalable).Replicas(),
+			})
+		}
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		return progress[i].Kind+"/"+progress[i].Name < progress[j].Kind+"/"+progress[j].Name
+	})
+	return progress
+}
+
+// nextSleep is the next run of the KubeSnooze's sleep schedule in its
+// timezone, or the zero time when it has none or it does not parse.
+func nextSleep(item *kubesnoozev1alpha1.KubeSnooze, now time.Time) time.Time {
+	if item.Spec.SleepCron == "" {
+		return time.Time{}
+	}
+	schedule, err := cron.Parse(item.Spec.SleepCron)
+	if err != nil {
+		return time.Time{}
+	}
+	loc := time.UTC
+	if item.Spec.Timezone != "" {
+		if parsed, err := time.LoadLocation(item.Spec.Timezone); err == nil {
+			loc = parsed
+		}
+	}
+	return schedule.Next(now.In(loc))
+}
+
+// splashTemplate is the built-in page.
+var splashTemplate = template.Must(template.New("splash").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+  <meta charset="UTF-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1" />
+  <title>{{ .Title }}</title>
+  <style>
+    /* Dark theme baseline with high contrast text. */
+    body {
+      margin: 0;
+      padding: 0;
+      font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+      background: #0b1220;
+      color: #f8fafc;
+    }
+    /* Center the card both vertically and horizontally. */
+    .wrap {
+      min-height: 100vh;
+      display: flex;
+      align-items: center;
+      justify-content: center;
+      padding: 2rem;
+    }
+    /* Card container with subtle depth. */
+    .card {
+      max-width: 560px;
+      width: 100%;
+      background: #111827;
+      border-radius: 16px;
+      padding: 32px;
+      box-shadow: 0 12px 30px rgba(0, 0, 0, 0.35);
+    }
+    /* Primary message styling. */
+    h1 {
+      margin: 0 0 12px 0;
+      font-size: 28px;
+      font-weight: 700;
+    }
+    /* Supporting copy with softer contrast. */
+    p {
+      margin: 0;
+      font-size: 16px;
+      line-height: 1.6;
+      color: #cbd5f5;
+    }
+    /* Subtle hint text. */
+    .hint {
+      margin-top: 20px;
+      font-size: 13px;
+      color: #94a3b8;
+    }
+    /* Wake progress bar and workload list. */
+    .bar {
+      margin-top: 20px;
+      height: 8px;
+      border-radius: 4px;
+      background: #1f2937;
+      overflow: hidden;
+    }
+    .bar span {
+      display: block;
+      height: 100%;
+      background: #38bdf8;
+    }
+    ul {
+      margin: 16px 0 0 0;
+      padding: 0;
+      list-style: none;
+      font-size: 14px;
+      color: #cbd5f5;
+    }
+    li.done {
+      color: #86efac;
+    }
+  </style>
+</head>
+<body>
+  <div class="wrap">
+    <div class="card">
+      <h1>{{ .Title }}</h1>
+      <p>{{ .Message }}</p>
+      {{- if .Workloads }}
+      <div class="bar"><span style="width: {{ .Percent }}%"></span></div>
+      <ul>
+        {{- range .Workloads }}
+        <li{{ if .Done }} class="done"{{ end }}>{{ .Kind }} {{ .Name }}: {{ .Ready }}/{{ .Desired }} {{ $.T "ready" }}</li>
+        {{- end }}
+      </ul>
+      {{- end }}
+      <p class="hint">
+        {{- if .Environment }}{{ .Environment }}. {{ end }}
+        {{- if .LastSleep }}{{ .T "asleepSince" }} {{ .LastSleep.Format "2006-01-02 15:04 MST" }}. {{ end }}
+        {{- if .NextSleep }}{{ .T "nextSleep" }} {{ .NextSleep.Format "2006-01-02 15:04 MST" }}. {{ end }}
+        {{- if .Requester }}{{ .T "requestedBy" }} {{ .Requester }}. {{ end -}}
+        {{ .T "refreshHint" }}
+      </p>
+    </div>
+  </div>
+  <script>
+    setTimeout(function () {
+      window.location.reload();
+    }, {{ .RefreshSeconds }} * 1000);
+  </script>
+</body>
+</html>`))
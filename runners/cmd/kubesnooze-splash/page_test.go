@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	"kubesnooze/pkg/snooze"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLoadPageTemplate(t *testing.T) {
+	if tpl, err := loadPageTemplate(""); err != nil || tpl != splashTemplate {
+		t.Fatalf("unset dir = %v, %v; want built-in page", tpl, err)
+	}
+	dir := t.TempDir()
+	if tpl, err := loadPageTemplate(dir); err != nil || tpl != splashTemplate {
+		t.Fatalf("dir without %s = %v, %v; want built-in page", pageTemplateFile, tpl, err)
+	}
+
+	writeFile(t, filepath.Join(dir, pageTemplateFile), `<h1>{{ .Environment }}</h1><img src="{{ .AssetsPath }}logo.svg">`)
+	tpl, err := loadPageTemplate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tpl.Execute(&out, pageData{Environment: "staging", AssetsPath: assetsPath}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<h1>staging</h1><img src="/_kubesnooze/assets/logo.svg">`; out.String() != want {
+		t.Errorf("custom page = %q, want %q", out.String(), want)
+	}
+
+	writeFile(t, filepath.Join(dir, pageTemplateFile), `{{ .Broken`)
+	if _, err := loadPageTemplate(dir); err == nil {
+		t.Error("invalid template loaded")
+	}
+}
+
+func TestAssetHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "logo.svg"), "<svg/>")
+	handler := assetHandler(dir)
+
+	for path, want := range map[string]int{
+		assetsPath + "logo.svg":    http.StatusOK,
+		assetsPath:                 http.StatusNotFound,
+		assetsPath + "missing.css": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestPageData(t *testing.T) {
+	replicas := int32(2)
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "dev", Labels: map[string]string{"app": "shop"}},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 2},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "dev", Labels: map[string]string{"app": "shop"}},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+			Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1},
+		},
+	)
+	lastSleep := metav1.NewTime(time.Date(2024, 5, 6, 19, 0, 0, 0, time.UTC))
+	item := &kubesnoozev1alpha1.KubeSnooze{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "dev"},
+		Spec:       kubesnoozev1alpha1.KubeSnoozeSpec{SleepCron: "0 19 * * *"},
+		Status:     kubesnoozev1alpha1.KubeSnoozeStatus{LastSleepTime: &lastSleep},
+	}
+	s := &wakeService{
+		config:  &splashConfig{namespace: "dev", title: "Waking", message: "Hang on"},
+		snoozes: crfake.NewClientBuilder().WithScheme(scheme).WithObjects(item).Build(),
+	}
+	wake := wakeTarget{
+		engine: &snooze.Engine{Client: clientset},
+		target: snooze.Target{Namespace: "dev", Selectors: []labels.Selector{labels.SelectorFromSet(labels.Set{"app": "shop"})}},
+		snooze: client.ObjectKeyFromObject(item),
+	}
+	r := withIdentity(httptest.NewRequest(http.MethodGet, "/", nil), identity{user: "alice"})
+
+	data := s.pageData(context.Background(), r, []wakeTarget{wake}, wakeTriggered, nil)
+	if data.State != "waking" || data.Environment != "shop" || data.Requester != "alice" {
+		t.Errorf("page = %+v", data)
+	}
+	want := []workloadProgress{
+		{Kind: snooze.KindDeployment, Name: "web", Ready: 2, Desired: 2},
+		{Kind: snooze.KindStatefulSet, Name: "db", Ready: 1, Desired: 2},
+	}
+	if len(data.Workloads) != len(want) {
+		t.Fatalf("workloads = %+v, want %+v", data.Workloads, want)
+	}
+	for _, progress := range want {
+		found := false
+		for _, got := range data.Workloads {
+			found = found || got == progress
+		}
+		if !found {
+			t.Errorf("workloads = %+v, missing %+v", data.Workloads, progress)
+		}
+	}
+	if data.ReadyWorkloads != 1 || data.Percent() != 50 || data.Awake() {
+		t.Errorf("ready = %d percent = %d awake = %v, want 1, 50, false", data.ReadyWorkloads, data.Percent(), data.Awake())
+	}
+	if data.LastSleep == nil || !data.LastSleep.Equal(lastSleep.Time) {
+		t.Errorf("last sleep = %v, want %v", data.LastSleep, lastSleep.Time)
+	}
+	if data.NextSleep == nil || data.NextSleep.Hour() != 19 || !data.NextSleep.After(time.Now()) {
+		t.Errorf("next sleep = %v, want the next 19:00", data.NextSleep)
+	}
+
+	var out strings.Builder
+	if err := splashTemplate.Execute(&out, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Deployment web: 2/2 ready", "width: 50%", "Requested by alice"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("built-in page is missing %q", want)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hostRouteWeight ranks a host match above any path prefix length.
+const hostRouteWeight = 1 << 20
+
+var errNoRoute = errors.New("no KubeSnooze routes this request")
+
+// route finds the KubeSnooze whose splashRoutes match the request best.
+func (s *wakeService) route(ctx context.Context, r *http.Request) (*kubesnoozev1alpha1.KubeSnooze, error) {
+	var list kubesnoozev1alpha1.KubeSnoozeList
+	if err := s.snoozes.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	host, path := requestHost(r), r.URL.Path
+	if strings.HasPrefix(path, apiPrefix) {
+		// API calls name the environment's path, since their own is fixed.
+		path = r.URL.Query().Get("path")
+	}
+	item := matchRoute(list.Items, host, path)
+	if item == nil {
+		return nil, fmt.Errorf("%w: %s%s", errNoRoute, host, path)
+	}
+	return item, nil
+}
+
+// matchRoute returns the KubeSnooze with the most specific matching route;
+// ties go to the first by namespace and name so the choice is stable.
+func matchRoute(items []kubesnoozev1alpha1.KubeSnooze, host, path string) *kubesnoozev1alpha1.KubeSnooze {
+	var best *kubesnoozev1alpha1.KubeSnooze
+	bestScore := -1
+	for i := range items {
+		item := &items[i]
+		if item.Namespace == "kube-system" {
+			continue
+		}
+		for _, route := range item.Spec.SplashRoutes {
+			score, ok := routeScore(route, host, path)
+			if !ok || score < bestScore {
+				continue
+			}
+			if score == bestScore && client.ObjectKeyFromObject(item).String() > client.ObjectKeyFromObject(best).String() {
+				continue
+			}
+			best, bestScore = item, score
+		}
+	}
+	return best
+}
+
+func routeScore(route kubesnoozev1alpha1.SplashRoute, host, path string) (int, bool) {
+	if route.Host == "" && route.PathPrefix == "" {
+		return 0, false
+	}
+	score := 0
+	if route.Host != "" {
+		if !strings.EqualFold(route.Host, host) {
+			return 0, false
+		}
+		score += hostRouteWeight
+	}
+	if route.PathPrefix != "" {
+		// Match whole path segments, like an Ingress Prefix path.
+		prefix := strings.TrimSuffix(route.PathPrefix, "/")
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			return 0, false
+		}
+		score += len(prefix) + 1
+	}
+	return score, true
+}
+
+func requestHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return r.Host
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func routedSnooze(namespace, name string, routes ...kubesnoozev1alpha1.SplashRoute) kubesnoozev1alpha1.KubeSnooze {
+	return kubesnoozev1alpha1.KubeSnooze{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       kubesnoozev1alpha1.KubeSnoozeSpec{SplashRoutes: routes},
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	items := []kubesnoozev1alpha1.KubeSnooze{
+		routedSnooze("team-a", "dev", kubesnoozev1alpha1.SplashRoute{Host: "a.example.com"}),
+		routedSnooze("team-b", "dev", kubesnoozev1alpha1.SplashRoute{PathPrefix: "/b"}),
+		routedSnooze("team-b", "api", kubesnoozev1alpha1.SplashRoute{PathPrefix: "/b/api/"}),
+		routedSnooze("team-c", "dev", kubesnoozev1alpha1.SplashRoute{Host: "shared.example.com", PathPrefix: "/c"}),
+		routedSnooze("kube-system", "dev", kubesnoozev1alpha1.SplashRoute{Host: "system.example.com"}),
+	}
+
+	tests := []struct {
+		name string
+		host string
+		path string
+		want string
+	}{
+		{name: "host", host: "A.example.com", path: "/anything", want: "team-a/dev"},
+		{name: "path prefix", host: "shared.example.com", path: "/b/web", want: "team-b/dev"},
+		{name: "longest prefix", host: "shared.example.com", path: "/b/api/users", want: "team-b/api"},
+		{name: "whole segments only", host: "shared.example.com", path: "/bravo", want: ""},
+		{name: "host and path", host: "shared.example.com", path: "/c", want: "team-c/dev"},
+		{name: "host and path mismatch", host: "other.example.com", path: "/c", want: ""},
+		{name: "kube-system ignored", host: "system.example.com", path: "/", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if item := matchRoute(items, tt.host, tt.path); item != nil {
+				got = item.Namespace + "/" + item.Name
+			}
+			if got != tt.want {
+				t.Errorf("matchRoute(%q, %q) = %q, want %q", tt.host, tt.path, got, tt.want)
+			}
+		})
+	}
+}
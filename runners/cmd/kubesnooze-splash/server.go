@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	envTLSCertFile           = "KUBESNOOZE_TLS_CERT_FILE"
+	envTLSKeyFile            = "KUBESNOOZE_TLS_KEY_FILE"
+	envMetricsPort           = "KUBESNOOZE_METRICS_PORT"
+	envShutdownTimeout       = "KUBESNOOZE_SHUTDOWN_TIMEOUT"
+	envContentSecurityPolicy = "KUBESNOOZE_CONTENT_SECURITY_POLICY"
+
+	defaultMetricsPort     = "9090"
+	defaultShutdownTimeout = 30 * time.Second
+	// shutdownDelay keeps serving after readiness fails, while endpoints
+	// and load balancers stop sending traffic.
+	shutdownDelay    = 5 * time.Second
+	certReloadPeriod = 10 * time.Second
+	maxAccessBackoff = 30 * time.Second
+
+	// defaultContentSecurityPolicy allows the built-in page's inline style and
+	// reload script, and assets from the splash itself.
+	defaultContentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; " +
+		"style-src 'self' 'unsafe-inline'; img-src 'self' data:; " +
+		"frame-ancestors 'none'; base-uri 'none'; form-action 'self'"
+)
+
+// serverConfig is how the splash serves HTTP.
+type serverConfig struct {
+	tlsCertFile           string
+	tlsKeyFile            string
+	metricsPort           string
+	shutdownTimeout       time.Duration
+	contentSecurityPolicy string
+}
+
+func loadServerConfig() (serverConfig, error) {
+	config := serverConfig{
+		tlsCertFile:           os.Getenv(envTLSCertFile),
+		tlsKeyFile:            os.Getenv(envTLSKeyFile),
+		metricsPort:           os.Getenv(envMetricsPort),
+		shutdownTimeout:       defaultShutdownTimeout,
+		contentSecurityPolicy: os.Getenv(envContentSecurityPolicy),
+	}
+	if (config.tlsCertFile == "") != (config.tlsKeyFile == "") {
+		return serverConfig{}, fmt.Errorf("set both %s and %s to serve TLS", envTLSCertFile, envTLSKeyFile)
+	}
+	if config.metricsPort == "" {
+		config.metricsPort = defaultMetricsPort
+	}
+	if raw := os.Getenv(envShutdownTimeout); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout < 0 {
+			return serverConfig{}, fmt.Errorf("invalid %s: %q", envShutdownTimeout, raw)
+		}
+		config.shutdownTimeout = timeout
+	}
+	if config.contentSecurityPolicy == "" {
+		config.contentSecurityPolicy = defaultContentSecurityPolicy
+	}
+	return config, nil
+}
+
+func (c serverConfig) tls() bool { return c.tlsCertFile != "" }
+
+// securityHeaders sets browser hardening headers on every response.
+func securityHeaders(config serverConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Content-Security-Policy", config.contentSecurityPolicy)
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		if config.tls() {
+			header.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// certReloader serves the certificate of a mounted TLS Secret, picking up
+// renewals without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	contents []byte
+	cert     *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// reload re-reads the key pair and reports whether it changed.
+func (c *certReloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(c.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	contents := append(append([]byte{}, certPEM...), keyPEM...)
+	c.mu.RLock()
+	unchanged := c.cert != nil && bytes.Equal(contents, c.contents)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		// The Secret may be mid-update, with the new cert and the old key.
+		return false, fmt.Errorf("%s: %w", c.certFile, err)
+	}
+	c.mu.Lock()
+	c.contents, c.cert = contents, &cert
+	c.mu.Unlock()
+	return true, nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// watch reloads the key pair when it changes, until ctx is done.
+func (c *certReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(certReloadPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := c.reload()
+			if err != nil {
+				// Keep serving the last good certificate.
+				fmt.Fprintf(os.Stderr, "reload TLS certificate: %v\n", err)
+			} else if changed {
+				fmt.Printf("reloaded %s\n", c.certFile)
+			}
+		}
+	}
+}
+
+// splashMetrics are served on the metrics port.
+type splashMetrics struct {
+	registry     *prometheus.Registry
+	requests     *prometheus.CounterVec
+	wakes        *prometheus.CounterVec
+	wakeDuration prometheus.Histogram
+}
+
+func newSplashMetrics() *splashMetrics {
+	m := &splashMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubesnooze_splash_requests_total",
+			Help: "HTTP requests served, by status code and method.",
+		}, []string{"code", "method"}),
+		wakes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubesnooze_splash_wakes_total",
+			Help: "Wake requests, by audit result.",
+		}, []string{"result"}),
+		wakeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "kubesnooze_splash_wake_duration_seconds",
+			Help:    "Time taken to scale up a wake target.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.wakes, m.wakeDuration,
+	)
+	return m
+}
+
+// instrument counts the requests next serves.
+func (m *splashMetrics) instrument(next http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerCounter(m.requests, next)
+}
+
+// wake counts an audited wake request; a nil m ignores it.
+func (m *splashMetrics) wake(result string) {
+	if m != nil {
+		m.wakes.WithLabelValues(result).Inc()
+	}
+}
+
+// observeWake records how long a wake took; a nil m ignores it.
+func (m *splashMetrics) observeWake(took time.Duration) {
+	if m != nil {
+		m.wakeDuration.Observe(took.Seconds())
+	}
+}
+
+// healthRoutes serves probes and metrics on their own port, so they stay
+// reachable without the splash's login and are not exposed by its Ingress.
+func (s *wakeService) healthRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	if s.metrics != nil {
+		mux.Handle("/metrics", promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}))
+	}
+	return mux
+}
+
+// verifyAPIAccess marks the splash ready once it can list the workloads it
+// wakes, retrying with backoff until ctx is done.
+func (s *wakeService) verifyAPIAccess(ctx context.Context) {
+	backoff := time.Second
+	for {
+		_, err := s.clientset.AppsV1().Deployments(s.config.namespace).List(ctx, metav1.ListOptions{Limit: 1})
+		if err == nil {
+			s.ready.Store(true)
+			fmt.Println("verified API access")
+			return
+		}
+		fmt.Fprintf(os.Stderr, "verify API access: %v\n", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxAccessBackoff {
+			backoff = maxAccessBackoff
+		}
+	}
+}
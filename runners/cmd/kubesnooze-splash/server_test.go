@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kubesnooze/pkg/snooze"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := securityHeaders(serverConfig{contentSecurityPolicy: defaultContentSecurityPolicy, tlsCertFile: "tls.crt"},
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	for header, want := range map[string]string{
+		"Content-Security-Policy":   defaultContentSecurityPolicy,
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Strict-Transport-Security": "max-age=31536000",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	t.Setenv(envTLSCertFile, "/tls/tls.crt")
+	if _, err := loadServerConfig(); err == nil {
+		t.Error("certificate without a key accepted")
+	}
+	t.Setenv(envTLSKeyFile, "/tls/tls.key")
+	t.Setenv(envShutdownTimeout, "45s")
+	config, err := loadServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.tls() || config.shutdownTimeout != 45*time.Second || config.metricsPort != defaultMetricsPort {
+		t.Errorf("config = %+v", config)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeKeyPair(t, certFile, keyFile, "one.example.com")
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := reloader.reload(); changed || err != nil {
+		t.Errorf("reload of unchanged files = %v, %v", changed, err)
+	}
+
+	writeKeyPair(t, certFile, keyFile, "two.example.com")
+	if changed, err := reloader.reload(); !changed || err != nil {
+		t.Fatalf("reload of renewed files = %v, %v", changed, err)
+	}
+	cert, _ := reloader.getCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "two.example.com" {
+		t.Errorf("serving %s, want the renewed certificate", leaf.Subject.CommonName)
+	}
+
+	// A broken update keeps the last good pair.
+	writeFile(t, certFile, "not a certificate")
+	if _, err := reloader.reload(); err == nil {
+		t.Error("broken certificate loaded")
+	}
+	if current, _ := reloader.getCertificate(nil); current != cert {
+		t.Error("broken reload replaced the certificate")
+	}
+}
+
+func TestHealthRoutes(t *testing.T) {
+	s := &wakeService{
+		clientset: fake.NewSimpleClientset(),
+		config:    &splashConfig{namespace: "dev"},
+		metrics:   newSplashMetrics(),
+	}
+	handler := s.healthRoutes()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("healthz = %d, want 200", rec.Code)
+	}
+	if rec := get("/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before API access = %d, want 503", rec.Code)
+	}
+	s.verifyAPIAccess(context.Background())
+	if rec := get("/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("readyz after API access = %d, want 200", rec.Code)
+	}
+
+	s.metrics.wake(snooze.AuditSucceeded)
+	if body := get("/metrics").Body.String(); !strings.Contains(body, `kubesnooze_splash_wakes_total{result="Succeeded"} 1`) {
+		t.Errorf("metrics are missing the wake counter:\n%s", body)
+	}
+}
+
+func writeKeyPair(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+}
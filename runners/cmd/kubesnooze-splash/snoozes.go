@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kubesnoozev1alpha1 "kubesnooze/api/v1alpha1"
+	"kubesnooze/pkg/snooze"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// wakeTarget is one Apply call of a splash wake.
+type wakeTarget struct {
+	engine *snooze.Engine
+	target snooze.Target
+	// snooze is the KubeSnooze the wake follows, if any.
+	snooze client.ObjectKey
+}
+
+// startSnoozeCache starts an informer on the KubeSnoozes of namespace, or of
+// the whole cluster when it is empty, and waits for its first sync.
+func startSnoozeCache(ctx context.Context, restConfig *rest.Config, namespace string) (client.Reader, error) {
+	options := cache.Options{Scheme: scheme}
+	if namespace != "" {
+		options.DefaultNamespaces = map[string]cache.Config{namespace: {}}
+	}
+	snoozeCache, err := cache.New(restConfig, options)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := snoozeCache.GetInformer(ctx, &kubesnoozev1alpha1.KubeSnooze{}); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := snoozeCache.Start(ctx); err != nil {
+			fail(err)
+		}
+	}()
+
+	syncCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if !snoozeCache.WaitForCacheSync(syncCtx) {
+		return nil, fmt.Errorf("timed out waiting for the KubeSnooze informer to sync")
+	}
+	return snoozeCache, nil
+}
+
+// wakeTargets resolves what a wake applies. In snooze mode the selectors come
+// from KubeSnooze specs: the named one, or every KubeSnooze in the namespace.
+// Other modes, and a ?service override, resolve selectors from env vars or
+// Services, using the named KubeSnooze's wake behavior when one is set.
+func (s *wakeService) wakeTargets(ctx context.Context, serviceOverride *corev1.Service) ([]wakeTarget, error) {
+	if s.config.serviceMode == "snooze" && serviceOverride == nil {
+		items, err := s.selectedSnoozes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		wakes := make([]wakeTarget, 0, len(items))
+		for i := range items {
+			wake, err := s.snoozeWakeTarget(&items[i])
+			if err != nil {
+				return nil, err
+			}
+			wakes = append(wakes, wake)
+		}
+		return wakes, nil
+	}
+
+	wake := wakeTarget{engine: s.engine, target: snooze.Target{Namespace: s.config.namespace}}
+	if s.config.snoozeName != "" {
+		items, err := s.selectedSnoozes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if wake, err = s.snoozeWakeTarget(&items[0]); err != nil {
+			return nil, err
+		}
+	}
+	selectors, err := resolveSelectors(ctx, s.clientset, s.config, serviceOverride)
+	if err != nil {
+		return nil, err
+	}
+	wake.target.Selectors = selectors
+	return []wakeTarget{wake}, nil
+}
+
+// selectedSnoozes returns the configured KubeSnooze, or all of them in the
+// namespace when none is named.
+func (s *wakeService) selectedSnoozes(ctx context.Context) ([]kubesnoozev1alpha1.KubeSnooze, error) {
+	if s.config.snoozeName != "" {
+		item := kubesnoozev1alpha1.KubeSnooze{}
+		if err := s.snoozes.Get(ctx, client.ObjectKey{Namespace: s.config.namespace, Name: s.config.snoozeName}, &item); err != nil {
+			return nil, err
+		}
+		return []kubesnoozev1alpha1.KubeSnooze{item}, nil
+	}
+
+	var list kubesnoozev1alpha1.KubeSnoozeList
+	if err := s.snoozes.List(ctx, &list, client.InNamespace(s.config.namespace)); err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, fmt.Errorf("no KubeSnoozes found in namespace %s", s.config.namespace)
+	}
+	return list.Items, nil
+}
+
+// snoozeWakeTarget runs exactly the wake the schedule would, snapshot and
+// CronJobs included.
+func (s *wakeService) snoozeWakeTarget(item *kubesnoozev1alpha1.KubeSnooze) (wakeTarget, error) {
+	engine, target, err := snooze.FromKubeSnooze(s.clientset, item)
+	if err != nil {
+		return wakeTarget{}, err
+	}
+	engine.Logf = s.engine.Logf
+	return wakeTarget{engine: engine, target: target, snooze: client.ObjectKeyFromObject(item)}, nil
+}
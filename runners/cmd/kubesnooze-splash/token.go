@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	envAuthToken      = "KUBESNOOZE_AUTH_TOKEN"
+	envTokenReview    = "KUBESNOOZE_TOKEN_REVIEW"
+	envTokenAudiences = "KUBESNOOZE_TOKEN_AUDIENCES"
+
+	// defaultTokenAudience is what reviewed tokens must be issued for unless
+	// KUBESNOOZE_TOKEN_AUDIENCES says otherwise, so that tokens meant for the
+	// API server or other services are not accepted.
+	defaultTokenAudience = "kubesnooze-splash"
+
+	// staticTokenUser is the identity audited for the shared static token.
+	staticTokenUser    = "static-token"
+	tokenReviewTimeout = 10 * time.Second
+	// tokenCacheTTL is how long a review is reused, and so how long a
+	// revoked token keeps working.
+	tokenCacheTTL        = 10 * time.Second
+	maxTokenCacheEntries = 1000
+)
+
+var errInvalidToken = errors.New("invalid bearer token")
+
+// tokenConfig is the bearer-token mode used by automation. A token is
+// accepted when it equals the static token, or when the API server's
+// TokenReview authenticates it (e.g. a ServiceAccount token).
+type tokenConfig struct {
+	static    string
+	review    bool
+	audiences []string
+}
+
+func loadTokenConfig() (tokenConfig, error) {
+	config := tokenConfig{
+		static:    strings.TrimSpace(os.Getenv(envAuthToken)),
+		audiences: splitList(os.Getenv(envTokenAudiences)),
+	}
+	if raw := os.Getenv(envTokenReview); raw != "" {
+		review, err := strconv.ParseBool(raw)
+		if err != nil {
+			return tokenConfig{}, fmt.Errorf("invalid %s: %q", envTokenReview, raw)
+		}
+		config.review = review
+	}
+	if config.static == "" && !config.review {
+		return tokenConfig{}, fmt.Errorf("set %s or %s=true in token auth mode", envAuthToken, envTokenReview)
+	}
+	if len(config.audiences) == 0 {
+		config.audiences = []string{defaultTokenAudience}
+	}
+	return config, nil
+}
+
+type tokenAuth struct {
+	config    tokenConfig
+	clientset kubernetes.Interface
+	now       func() time.Time
+
+	// reviews caches TokenReview results by token hash, so a client polling
+	// the status API does not cost a review per request.
+	mu      sync.Mutex
+	reviews map[[sha256.Size]byte]cachedReview
+}
+
+type cachedReview struct {
+	id      identity
+	valid   bool
+	expires time.Time
+}
+
+func newTokenAuth(config tokenConfig, clientset kubernetes.Interface) *tokenAuth {
+	return &tokenAuth{
+		config:    config,
+		clientset: clientset,
+		now:       time.Now,
+		reviews:   map[[sha256.Size]byte]cachedReview{},
+	}
+}
+
+func (t *tokenAuth) require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kubesnooze"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		id, err := t.authenticate(r.Context(), token)
+		if errors.Is(err, errInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kubesnooze", error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "token review failed: %v\n", err)
+			http.Error(w, "Token review unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, withIdentity(r, id))
+	}
+}
+
+func (t *tokenAuth) authenticate(ctx context.Context, token string) (identity, error) {
+	if t.config.static != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.config.static)) == 1 {
+		return identity{user: staticTokenUser, method: "token"}, nil
+	}
+	if !t.config.review {
+		return identity{}, errInvalidToken
+	}
+
+	key := sha256.Sum256([]byte(token))
+	result, ok := t.cached(key)
+	if !ok {
+		var err error
+		if result, err = t.review(ctx, token); err != nil {
+			return identity{}, err
+		}
+		t.store(key, result)
+	}
+	if !result.valid {
+		return identity{}, errInvalidToken
+	}
+	return result.id, nil
+}
+
+func (t *tokenAuth) review(ctx context.Context, token string) (cachedReview, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenReviewTimeout)
+	defer cancel()
+	review, err := t.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: t.config.audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return cachedReview{}, err
+	}
+	// An authenticator that ignores audiences returns none; such a token
+	// could have been issued for anything.
+	if !review.Status.Authenticated || !sharesAudience(review.Status.Audiences, t.config.audiences) {
+		return cachedReview{}, nil
+	}
+	return cachedReview{
+		id: identity{
+			user:   review.Status.User.Username,
+			groups: review.Status.User.Groups,
+			method: "tokenreview",
+		},
+		valid: true,
+	}, nil
+}
+
+func (t *tokenAuth) cached(key [sha256.Size]byte) (cachedReview, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result, ok := t.reviews[key]
+	if !ok || !t.now().Before(result.expires) {
+		return cachedReview{}, false
+	}
+	return result, true
+}
+
+// store caches a review. If the cache is full of live entries it is cleared
+// rather than grown without bound.
+func (t *tokenAuth) store(key [sha256.Size]byte, result cachedReview) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if len(t.reviews) >= maxTokenCacheEntries {
+		for cachedKey, cached := range t.reviews {
+			if !now.Before(cached.expires) {
+				delete(t.reviews, cachedKey)
+			}
+		}
+		if len(t.reviews) >= maxTokenCacheEntries {
+			t.reviews = map[[sha256.Size]byte]cachedReview{}
+		}
+	}
+	result.expires = now.Add(tokenCacheTTL)
+	t.reviews[key] = result
+}
+
+func sharesAudience(granted, wanted []string) bool {
+	for _, audience := range granted {
+		for _, want := range wanted {
+			if audience == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
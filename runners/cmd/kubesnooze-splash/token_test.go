@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestTokenAuth(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "sa-token":
+			review.Status.Authenticated = true
+			review.Status.Audiences = review.Spec.Audiences
+			review.Status.User = authenticationv1.UserInfo{
+				Username: "system:serviceaccount:ci:deployer",
+				Groups:   []string{"system:serviceaccounts"},
+			}
+		case "api-token":
+			// Valid, but issued for the API server rather than the splash.
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "system:serviceaccount:ci:deployer"}
+		case "broken":
+			return true, nil, errors.New("apiserver unavailable")
+		}
+		return true, review, nil
+	})
+	auth := newTokenAuth(tokenConfig{static: "shared-secret", review: true, audiences: []string{defaultTokenAudience}}, clientset)
+
+	var got identity
+	protected := auth.require(func(w http.ResponseWriter, r *http.Request) {
+		got = identityFrom(r.Context())
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+		wantUser      string
+	}{
+		{name: "static token", authorization: "Bearer shared-secret", want: http.StatusOK, wantUser: staticTokenUser},
+		{name: "token review", authorization: "bearer sa-token", want: http.StatusOK, wantUser: "system:serviceaccount:ci:deployer"},
+		{name: "rejected token", authorization: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "other audience", authorization: "Bearer api-token", want: http.StatusUnauthorized},
+		{name: "review failure", authorization: "Bearer broken", want: http.StatusServiceUnavailable},
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "basic credentials", authorization: "Basic dXNlcjpwYXNz", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = identity{}
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			protected(recorder, request)
+			if recorder.Code != tt.want {
+				t.Fatalf("status %d, want %d", recorder.Code, tt.want)
+			}
+			if got.user != tt.wantUser {
+				t.Errorf("user = %q, want %q", got.user, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestStaticTokenWithoutReview(t *testing.T) {
+	auth := &tokenAuth{config: tokenConfig{static: "shared-secret"}}
+	if _, err := auth.authenticate(context.Background(), "other"); !errors.Is(err, errInvalidToken) {
+		t.Errorf("err = %v, want invalid token", err)
+	}
+}
+
+func TestTokenReviewCache(t *testing.T) {
+	reviews := 0
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		review.Status.Authenticated = review.Spec.Token == "sa-token"
+		review.Status.Audiences = review.Spec.Audiences
+		return true, review, nil
+	})
+	t.Setenv(envTokenReview, "true")
+	config, err := loadTokenConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.audiences) != 1 || config.audiences[0] != defaultTokenAudience {
+		t.Fatalf("audiences = %v, want the splash default", config.audiences)
+	}
+	auth := newTokenAuth(config, clientset)
+	now := time.Date(2026, time.March, 4, 10, 0, 0, 0, time.UTC)
+	auth.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.authenticate(context.Background(), "sa-token"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := auth.authenticate(context.Background(), "nope"); !errors.Is(err, errInvalidToken) {
+			t.Fatalf("err = %v, want invalid token", err)
+		}
+	}
+	if reviews != 2 {
+		t.Errorf("reviews = %d, want one per token", reviews)
+	}
+
+	now = now.Add(tokenCacheTTL)
+	if _, err := auth.authenticate(context.Background(), "sa-token"); err != nil {
+		t.Fatal(err)
+	}
+	if reviews != 3 {
+		t.Errorf("reviews after the TTL = %d, want 3", reviews)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wakeState is what a request's wake call amounted to.
+type wakeState int
+
+const (
+	// wakeTriggered means this request started the wake.
+	wakeTriggered wakeState = iota
+	// wakeInProgress means another request is waking the same target.
+	wakeInProgress
+	// wakeCoolingDown means the target was woken within the cooldown.
+	wakeCoolingDown
+)
+
+func (s wakeState) String() string {
+	switch s {
+	case wakeTriggered:
+		return "triggered"
+	case wakeInProgress:
+		return "in-progress"
+	case wakeCoolingDown:
+		return "cooling-down"
+	}
+	return fmt.Sprintf("wakeState(%d)", int(s))
+}
+
+// wakeTracker runs wakes as background jobs, deduplicated per resolved
+// target: one job runs at a time per key, and a successful wake suppresses
+// further ones for the cooldown. Completed wakes are remembered in a bounded
+// cache, evicting the oldest.
+type wakeTracker struct {
+	cooldown   time.Duration
+	maxEntries int
+	now        func() time.Time
+	jobs       sync.WaitGroup
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+	lastWake map[string]time.Time
+	// failed holds the error of the last job per key until the next starts.
+	failed map[string]error
+}
+
+func newWakeTracker(cooldown time.Duration, maxEntries int) *wakeTracker {
+	return &wakeTracker{
+		cooldown:   cooldown,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		inFlight:   map[string]bool{},
+		lastWake:   map[string]time.Time{},
+		failed:     map[string]error{},
+	}
+}
+
+// start runs wake for key in the background unless a job for key is running
+// or cooling down. A failed job does not start a cooldown, so the next
+// request retries; that request also gets the failure, to show it.
+func (t *wakeTracker) start(key string, wake func() error) (wakeState, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inFlight[key] {
+		return wakeInProgress, nil
+	}
+	if last, ok := t.lastWake[key]; ok && t.now().Sub(last) < t.cooldown {
+		return wakeCoolingDown, nil
+	}
+	lastErr := t.failed[key]
+	delete(t.failed, key)
+	t.inFlight[key] = true
+
+	t.jobs.Add(1)
+	go func() {
+		defer t.jobs.Done()
+		err := wake()
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.inFlight, key)
+		if err == nil {
+			t.remember(key)
+			return
+		}
+		if len(t.failed) >= t.maxEntries {
+			t.failed = map[string]error{}
+		}
+		t.failed[key] = err
+	}()
+	return wakeTriggered, lastErr
+}
+
+// wait blocks until every running job is done or ctx ends.
+func (t *wakeTracker) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		t.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// running reports whether a wake for key is in flight.
+func (t *wakeTracker) running(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inFlight[key]
+}
+
+// remember records a completed wake; callers hold t.mu.
+func (t *wakeTracker) remember(key string) {
+	now := t.now()
+	if _, ok := t.lastWake[key]; !ok && len(t.lastWake) >= t.maxEntries {
+		oldestKey, oldest := "", now
+		for candidate, at := range t.lastWake {
+			if now.Sub(at) >= t.cooldown {
+				// Expired entries no longer throttle anything.
+				delete(t.lastWake, candidate)
+				continue
+			}
+			if !at.After(oldest) {
+				oldestKey, oldest = candidate, at
+			}
+		}
+		if len(t.lastWake) >= t.maxEntries {
+			delete(t.lastWake, oldestKey)
+		}
+	}
+	t.lastWake[key] = now
+}
+
+// wakeKey identifies what a set of wakes touches, so requests that resolve to
+// the same namespace and selectors share one wake however they were addressed.
+func wakeKey(wakes []wakeTarget) string {
+	parts := make([]string, 0, len(wakes))
+	for _, wake := range wakes {
+		selectors := make([]string, 0, len(wake.target.Selectors))
+		for _, selector := range wake.target.Selectors {
+			selectors = append(selectors, selector.String())
+		}
+		sort.Strings(selectors)
+		parts = append(parts, wake.target.Namespace+"/"+strings.Join(selectors, ";"))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
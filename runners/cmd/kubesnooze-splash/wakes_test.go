@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kubesnooze/pkg/snooze"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWakeTrackerInProgress(t *testing.T) {
+	tracker := newWakeTracker(time.Minute, 10)
+	release := make(chan struct{})
+	if state, _ := tracker.start("a", func() error { <-release; return nil }); state != wakeTriggered {
+		t.Errorf("first wake state = %v, want triggered", state)
+	}
+	if !tracker.running("a") {
+		t.Error("started wake is not running")
+	}
+
+	if state, _ := tracker.start("a", func() error { t.Error("coalesced wake ran"); return nil }); state != wakeInProgress {
+		t.Errorf("concurrent wake state = %v, want in progress", state)
+	}
+	ran := make(chan struct{})
+	if state, _ := tracker.start("b", func() error { close(ran); return nil }); state != wakeTriggered {
+		t.Errorf("other target state = %v, want triggered", state)
+	}
+	<-ran
+
+	close(release)
+	if err := tracker.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := tracker.start("a", func() error { return nil }); state != wakeCoolingDown {
+		t.Errorf("repeat wake state = %v, want cooling down", state)
+	}
+}
+
+func TestWakeTrackerWaitTimeout(t *testing.T) {
+	tracker := newWakeTracker(time.Minute, 10)
+	release := make(chan struct{})
+	defer close(release)
+	tracker.start("a", func() error { <-release; return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.wait(ctx); err == nil {
+		t.Error("wait returned before the wake finished")
+	}
+}
+
+func TestWakeTrackerCooldown(t *testing.T) {
+	now := time.Date(2026, time.March, 4, 10, 0, 0, 0, time.UTC)
+	tracker := newWakeTracker(10*time.Second, 2)
+	tracker.now = func() time.Time { return now }
+	run := func(key string, wake func() error) (wakeState, error) {
+		t.Helper()
+		state, err := tracker.start(key, wake)
+		if waitErr := tracker.wait(context.Background()); waitErr != nil {
+			t.Fatal(waitErr)
+		}
+		return state, err
+	}
+
+	if state, err := run("a", func() error { return errors.New("boom") }); state != wakeTriggered || err != nil {
+		t.Fatalf("failing wake = %v, %v; want triggered with no error yet", state, err)
+	}
+	// The retry reports the failure it follows.
+	if state, err := run("a", func() error { return nil }); state != wakeTriggered || err == nil {
+		t.Errorf("retry after failure = %v, %v; want triggered with the failure", state, err)
+	}
+
+	now = now.Add(11 * time.Second)
+	if state, err := run("a", func() error { return nil }); state != wakeTriggered || err != nil {
+		t.Errorf("wake after cooldown = %v, %v; want triggered", state, err)
+	}
+
+	// The cache holds two entries; a third evicts the oldest.
+	now = now.Add(time.Second)
+	run("b", func() error { return nil })
+	now = now.Add(time.Second)
+	run("c", func() error { return nil })
+	if len(tracker.lastWake) != 2 {
+		t.Errorf("cache size = %d, want 2", len(tracker.lastWake))
+	}
+	if _, ok := tracker.lastWake["a"]; ok {
+		t.Error("oldest entry not evicted")
+	}
+}
+
+func TestWakeKey(t *testing.T) {
+	a := labels.SelectorFromSet(labels.Set{"app": "a"})
+	b := labels.SelectorFromSet(labels.Set{"app": "b"})
+	first := []wakeTarget{{target: snooze.Target{Namespace: "dev", Selectors: []labels.Selector{a, b}}}}
+	second := []wakeTarget{{target: snooze.Target{Namespace: "dev", Selectors: []labels.Selector{b, a}}}}
+	if wakeKey(first) != wakeKey(second) {
+		t.Errorf("selector order changed the key: %q vs %q", wakeKey(first), wakeKey(second))
+	}
+	other := []wakeTarget{{target: snooze.Target{Namespace: "dev", Selectors: []labels.Selector{a}}}}
+	if wakeKey(first) == wakeKey(other) {
+		t.Error("different targets share a key")
+	}
+}
+
+func TestSelectorWakeLeavesCronJobs(t *testing.T) {
+	suspended := true
+	clientset := fake.NewSimpleClientset(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "dev", Labels: map[string]string{"app": "shop"}},
+		Spec:       batchv1.CronJobSpec{Suspend: &suspended},
+	})
+	engine := newEngine(clientset, &splashConfig{})
+	engine.Logf = nil
+	target := snooze.Target{Namespace: "dev", Selectors: []labels.Selector{labels.SelectorFromSet(labels.Set{"app": "shop"})}}
+
+	ctx := context.Background()
+	if _, err := engine.Apply(ctx, snooze.ActionWake, target); err != nil {
+		t.Fatal(err)
+	}
+	cronJob, err := clientset.BatchV1().CronJobs("dev").Get(ctx, "report", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cronJob.Spec.Suspend == nil || !*cronJob.Spec.Suspend {
+		t.Error("a splash wake without a KubeSnooze resumed a suspended CronJob")
+	}
+}